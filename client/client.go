@@ -0,0 +1,266 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sqladmin/v1"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// DefaultUserAgent is sent with every request unless overridden with WithUserAgent.
+const DefaultUserAgent = "sledge"
+
+// Client is the subset of the Cloud SQL Admin API that sledge uses.
+// Commands depend on this interface rather than on *sqladmin.Service so they
+// can be pointed at a fake, an emulator or any other implementation.
+type Client interface {
+	// Instances
+	ListInstances(ctx context.Context, project string) ([]*sqladmin.DatabaseInstance, error)
+	GetInstance(ctx context.Context, project, instance string) (*sqladmin.DatabaseInstance, error)
+	InsertInstance(ctx context.Context, project string, inst *sqladmin.DatabaseInstance) (*sqladmin.Operation, error)
+	PatchInstance(ctx context.Context, project, instance string, inst *sqladmin.DatabaseInstance) (*sqladmin.Operation, error)
+	DeleteInstance(ctx context.Context, project, instance string) (*sqladmin.Operation, error)
+	RestoreBackup(ctx context.Context, project, instance string, req *sqladmin.InstancesRestoreBackupRequest) (*sqladmin.Operation, error)
+
+	// Databases
+	ListDatabases(ctx context.Context, project, instance string) ([]*sqladmin.Database, error)
+	InsertDatabase(ctx context.Context, project, instance string, db *sqladmin.Database) (*sqladmin.Operation, error)
+
+	// Users
+	ListUsers(ctx context.Context, project, instance string) ([]*sqladmin.User, error)
+	InsertUser(ctx context.Context, project, instance string, user *sqladmin.User) (*sqladmin.Operation, error)
+
+	// BackupRuns
+	InsertBackupRun(ctx context.Context, project, instance string, run *sqladmin.BackupRun) (*sqladmin.Operation, error)
+	ListBackupRuns(ctx context.Context, project, instance string) ([]*sqladmin.BackupRun, error)
+	DeleteBackupRun(ctx context.Context, project, instance string, id int64) (*sqladmin.Operation, error)
+
+	// Operations
+	GetOperation(ctx context.Context, project, operation string) (*sqladmin.Operation, error)
+	ListOperations(ctx context.Context, project, instance string) ([]*sqladmin.Operation, error)
+	CancelOperation(ctx context.Context, project, operation string) error
+}
+
+// settings collects the values set by Options.
+type settings struct {
+	endpoint        string
+	credentialsFile string
+	userAgent       string
+	httpClient      *http.Client
+	noAuth          bool
+	logRequest      func(Request)
+}
+
+// Option configures a Client built by New.
+type Option func(*settings)
+
+// WithEndpoint overrides the Cloud SQL Admin API base URL, e.g. to target a
+// local emulator or an httptest server. Plain http:// endpoints are assumed to
+// be local stand-ins and are called without Google credentials.
+func WithEndpoint(endpoint string) Option {
+	return func(s *settings) { s.endpoint = endpoint }
+}
+
+// WithCredentialsFile authenticates with the given service account or
+// refresh token JSON file instead of Application Default Credentials.
+func WithCredentialsFile(path string) Option {
+	return func(s *settings) { s.credentialsFile = path }
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(s *settings) { s.userAgent = ua }
+}
+
+// WithHTTPClient uses the given HTTP client for all requests. The client is
+// used as-is, so it must handle authentication itself.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(s *settings) { s.httpClient = hc }
+}
+
+// WithoutAuthentication disables Google authentication entirely.
+func WithoutAuthentication() Option {
+	return func(s *settings) { s.noAuth = true }
+}
+
+// New creates a Client backed by the Cloud SQL Admin API.
+func New(ctx context.Context, opts ...Option) (Client, error) {
+	s := &settings{userAgent: DefaultUserAgent}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	clientOpts := []option.ClientOption{
+		option.WithScopes(sqladmin.CloudPlatformScope),
+	}
+	if s.endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(s.endpoint))
+		if strings.HasPrefix(s.endpoint, "http://") {
+			s.noAuth = true
+		}
+	}
+	var authOpts []option.ClientOption
+	switch {
+	case s.httpClient != nil:
+		clientOpts = append(clientOpts, option.WithHTTPClient(s.httpClient))
+	case s.noAuth:
+		clientOpts = append(clientOpts, option.WithoutAuthentication())
+	case s.credentialsFile != "":
+		authOpts = append(authOpts, option.WithCredentialsFile(s.credentialsFile))
+	}
+
+	if s.logRequest != nil {
+		hc, err := loggingHTTPClient(ctx, s, append(clientOpts, authOpts...))
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, option.WithHTTPClient(hc))
+	} else {
+		clientOpts = append(clientOpts, authOpts...)
+	}
+
+	svc, err := sqladmin.NewService(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sql admin service: %v", err)
+	}
+	svc.UserAgent = s.userAgent
+	return &service{svc: svc}, nil
+}
+
+// loggingHTTPClient returns an HTTP client that reports every request to
+// s.logRequest, wrapping the injected client or an authenticated transport
+// built from opts.
+func loggingHTTPClient(ctx context.Context, s *settings, opts []option.ClientOption) (*http.Client, error) {
+	switch {
+	case s.httpClient != nil:
+		hc := *s.httpClient
+		base := hc.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		hc.Transport = &loggingTransport{base: base, logf: s.logRequest}
+		return &hc, nil
+	case s.noAuth:
+		return &http.Client{Transport: &loggingTransport{base: http.DefaultTransport, logf: s.logRequest}}, nil
+	default:
+		rt, err := htransport.NewTransport(ctx, &loggingTransport{base: http.DefaultTransport, logf: s.logRequest}, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create authenticated transport: %v", err)
+		}
+		return &http.Client{Transport: rt}, nil
+	}
+}
+
+// service implements Client on top of the generated sqladmin package.
+type service struct {
+	svc *sqladmin.Service
+}
+
+// ListInstances returns every instance of the project, following pagination.
+func (s *service) ListInstances(ctx context.Context, project string) ([]*sqladmin.DatabaseInstance, error) {
+	var instances []*sqladmin.DatabaseInstance
+	err := s.svc.Instances.List(project).Pages(ctx, func(resp *sqladmin.InstancesListResponse) error {
+		instances = append(instances, resp.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+func (s *service) GetInstance(ctx context.Context, project, instance string) (*sqladmin.DatabaseInstance, error) {
+	return s.svc.Instances.Get(project, instance).Context(ctx).Do()
+}
+
+func (s *service) InsertInstance(ctx context.Context, project string, inst *sqladmin.DatabaseInstance) (*sqladmin.Operation, error) {
+	return s.svc.Instances.Insert(project, inst).Context(ctx).Do()
+}
+
+func (s *service) PatchInstance(ctx context.Context, project, instance string, inst *sqladmin.DatabaseInstance) (*sqladmin.Operation, error) {
+	return s.svc.Instances.Patch(project, instance, inst).Context(ctx).Do()
+}
+
+func (s *service) DeleteInstance(ctx context.Context, project, instance string) (*sqladmin.Operation, error) {
+	return s.svc.Instances.Delete(project, instance).Context(ctx).Do()
+}
+
+func (s *service) RestoreBackup(ctx context.Context, project, instance string, req *sqladmin.InstancesRestoreBackupRequest) (*sqladmin.Operation, error) {
+	return s.svc.Instances.RestoreBackup(project, instance, req).Context(ctx).Do()
+}
+
+func (s *service) ListDatabases(ctx context.Context, project, instance string) ([]*sqladmin.Database, error) {
+	resp, err := s.svc.Databases.List(project, instance).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+func (s *service) InsertDatabase(ctx context.Context, project, instance string, db *sqladmin.Database) (*sqladmin.Operation, error) {
+	return s.svc.Databases.Insert(project, instance, db).Context(ctx).Do()
+}
+
+func (s *service) ListUsers(ctx context.Context, project, instance string) ([]*sqladmin.User, error) {
+	resp, err := s.svc.Users.List(project, instance).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Items, nil
+}
+
+func (s *service) InsertUser(ctx context.Context, project, instance string, user *sqladmin.User) (*sqladmin.Operation, error) {
+	return s.svc.Users.Insert(project, instance, user).Context(ctx).Do()
+}
+
+func (s *service) InsertBackupRun(ctx context.Context, project, instance string, run *sqladmin.BackupRun) (*sqladmin.Operation, error) {
+	return s.svc.BackupRuns.Insert(project, instance, run).Context(ctx).Do()
+}
+
+// ListBackupRuns returns every backup run of the instance, following pagination.
+func (s *service) ListBackupRuns(ctx context.Context, project, instance string) ([]*sqladmin.BackupRun, error) {
+	var runs []*sqladmin.BackupRun
+	err := s.svc.BackupRuns.List(project, instance).Pages(ctx, func(resp *sqladmin.BackupRunsListResponse) error {
+		runs = append(runs, resp.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (s *service) DeleteBackupRun(ctx context.Context, project, instance string, id int64) (*sqladmin.Operation, error) {
+	return s.svc.BackupRuns.Delete(project, instance, id).Context(ctx).Do()
+}
+
+func (s *service) GetOperation(ctx context.Context, project, operation string) (*sqladmin.Operation, error) {
+	return s.svc.Operations.Get(project, operation).Context(ctx).Do()
+}
+
+// ListOperations returns the operations of a project, newest first, following
+// pagination. A non-empty instance restricts the list to that instance.
+func (s *service) ListOperations(ctx context.Context, project, instance string) ([]*sqladmin.Operation, error) {
+	call := s.svc.Operations.List(project)
+	if instance != "" {
+		call = call.Instance(instance)
+	}
+	var ops []*sqladmin.Operation
+	err := call.Pages(ctx, func(resp *sqladmin.OperationsListResponse) error {
+		ops = append(ops, resp.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+func (s *service) CancelOperation(ctx context.Context, project, operation string) error {
+	_, err := s.svc.Operations.Cancel(project, operation).Context(ctx).Do()
+	return err
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+// Request describes one HTTP request made to the Cloud SQL Admin API.
+type Request struct {
+	Method string
+	URL    string
+	// Status is the HTTP status code, 0 if no response was received.
+	Status  int
+	Latency time.Duration
+	// Err is the transport error, if the request failed without a response.
+	Err error
+}
+
+// WithRequestLogging calls logf after every HTTP request, e.g. to debug-log
+// API calls. Headers, which carry credentials, are not reported.
+func WithRequestLogging(logf func(Request)) Option {
+	return func(s *settings) { s.logRequest = logf }
+}
+
+// loggingTransport reports every round trip of base to logf.
+type loggingTransport struct {
+	base http.RoundTripper
+	logf func(Request)
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	r := Request{Method: req.Method, URL: req.URL.String(), Latency: time.Since(start), Err: err}
+	if resp != nil {
+		r.Status = resp.StatusCode
+	}
+	t.logf(r)
+	return resp, err
+}
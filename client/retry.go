@@ -0,0 +1,258 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sqladmin/v1"
+)
+
+// RetryPolicy configures NewRetrying. Zero values take the defaults noted
+// below.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per call, including the
+	// first (default 4). 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry (default 1s).
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries (default 30s).
+	MaxBackoff time.Duration
+	// RetryableCodes are the HTTP status codes worth retrying (default 429,
+	// 500, 502, 503 and 504).
+	RetryableCodes []int
+	// RetryConflicts also retries 409 "operation in progress" errors, which
+	// Cloud SQL returns while another operation runs on the instance.
+	RetryConflicts bool
+	// OnRetry, if set, is called before sleeping for each retry.
+	OnRetry func(Retry)
+}
+
+// Retry describes a call about to be retried.
+type Retry struct {
+	Method string
+	// Attempt is the number of the failed attempt, starting at 1.
+	Attempt     int
+	MaxAttempts int
+	Err         error
+	Wait        time.Duration
+}
+
+// DefaultRetryableCodes are the HTTP status codes retried by default.
+var DefaultRetryableCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// NewRetrying wraps c so that calls failing with transient errors are
+// retried with exponential backoff.
+//
+// Reads are retried on every retryable error. Calls that change something
+// (inserts, patches, restores and deletes) are only retried when the API
+// certainly rejected the request without acting on it: 429, 503 and 409
+// "operation in progress". After other errors, such as a 502 or a network
+// timeout, the request may have been carried out and retrying could, for
+// example, take a second backup, or fail a delete that succeeded with a
+// spurious 404.
+func NewRetrying(c Client, p RetryPolicy) Client {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 4
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = time.Second
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 30 * time.Second
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.RetryableCodes == nil {
+		p.RetryableCodes = DefaultRetryableCodes
+	}
+	return &retrying{next: c, policy: p}
+}
+
+type retrying struct {
+	next   Client
+	policy RetryPolicy
+}
+
+// idempotency of a call: whether repeating it after an ambiguous failure is
+// harmless.
+const (
+	idempotent    = true
+	notIdempotent = false
+)
+
+// retryCall runs call until it succeeds, fails permanently or runs out of
+// attempts.
+func retryCall[T any](ctx context.Context, r *retrying, method string, safe bool, call func() (T, error)) (T, error) {
+	backoff := r.policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		v, err := call()
+		if err == nil || attempt >= r.policy.MaxAttempts || !r.shouldRetry(err, safe) || ctx.Err() != nil {
+			return v, err
+		}
+
+		wait := jitter(backoff)
+		if r.policy.OnRetry != nil {
+			r.policy.OnRetry(Retry{Method: method, Attempt: attempt, MaxAttempts: r.policy.MaxAttempts, Err: err, Wait: wait})
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			var zero T
+			return zero, fmt.Errorf("%s: gave up retrying: %w (last error: %v)", method, ctx.Err(), err)
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > r.policy.MaxBackoff {
+			backoff = r.policy.MaxBackoff
+		}
+	}
+}
+
+// shouldRetry reports whether err is retryable for a call that is (safe)
+// or is not idempotent.
+func (r *retrying) shouldRetry(err error, safe bool) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		// Network errors leave it open whether the request was processed.
+		var nerr net.Error
+		return safe && errors.As(err, &nerr) && nerr.Timeout()
+	}
+	if gerr.Code == http.StatusConflict {
+		return r.policy.RetryConflicts && isOperationInProgress(gerr)
+	}
+	retryable := false
+	for _, code := range r.policy.RetryableCodes {
+		if gerr.Code == code {
+			retryable = true
+		}
+	}
+	if !retryable {
+		return false
+	}
+	return safe || gerr.Code == http.StatusTooManyRequests || gerr.Code == http.StatusServiceUnavailable
+}
+
+func isOperationInProgress(e *googleapi.Error) bool {
+	for _, item := range e.Errors {
+		if item.Reason == "operationInProgress" {
+			return true
+		}
+	}
+	return false
+}
+
+// jitter spreads d randomly by up to ±20%.
+func jitter(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()*0.4-0.2)*float64(d))
+}
+
+func (r *retrying) ListInstances(ctx context.Context, project string) ([]*sqladmin.DatabaseInstance, error) {
+	return retryCall(ctx, r, "instances.list", idempotent, func() ([]*sqladmin.DatabaseInstance, error) {
+		return r.next.ListInstances(ctx, project)
+	})
+}
+
+func (r *retrying) GetInstance(ctx context.Context, project, instance string) (*sqladmin.DatabaseInstance, error) {
+	return retryCall(ctx, r, "instances.get", idempotent, func() (*sqladmin.DatabaseInstance, error) {
+		return r.next.GetInstance(ctx, project, instance)
+	})
+}
+
+func (r *retrying) InsertInstance(ctx context.Context, project string, inst *sqladmin.DatabaseInstance) (*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "instances.insert", notIdempotent, func() (*sqladmin.Operation, error) {
+		return r.next.InsertInstance(ctx, project, inst)
+	})
+}
+
+func (r *retrying) PatchInstance(ctx context.Context, project, instance string, inst *sqladmin.DatabaseInstance) (*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "instances.patch", notIdempotent, func() (*sqladmin.Operation, error) {
+		return r.next.PatchInstance(ctx, project, instance, inst)
+	})
+}
+
+func (r *retrying) DeleteInstance(ctx context.Context, project, instance string) (*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "instances.delete", notIdempotent, func() (*sqladmin.Operation, error) {
+		return r.next.DeleteInstance(ctx, project, instance)
+	})
+}
+
+func (r *retrying) RestoreBackup(ctx context.Context, project, instance string, req *sqladmin.InstancesRestoreBackupRequest) (*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "instances.restoreBackup", notIdempotent, func() (*sqladmin.Operation, error) {
+		return r.next.RestoreBackup(ctx, project, instance, req)
+	})
+}
+
+func (r *retrying) ListDatabases(ctx context.Context, project, instance string) ([]*sqladmin.Database, error) {
+	return retryCall(ctx, r, "databases.list", idempotent, func() ([]*sqladmin.Database, error) {
+		return r.next.ListDatabases(ctx, project, instance)
+	})
+}
+
+func (r *retrying) InsertDatabase(ctx context.Context, project, instance string, db *sqladmin.Database) (*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "databases.insert", notIdempotent, func() (*sqladmin.Operation, error) {
+		return r.next.InsertDatabase(ctx, project, instance, db)
+	})
+}
+
+func (r *retrying) ListUsers(ctx context.Context, project, instance string) ([]*sqladmin.User, error) {
+	return retryCall(ctx, r, "users.list", idempotent, func() ([]*sqladmin.User, error) {
+		return r.next.ListUsers(ctx, project, instance)
+	})
+}
+
+func (r *retrying) InsertUser(ctx context.Context, project, instance string, user *sqladmin.User) (*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "users.insert", notIdempotent, func() (*sqladmin.Operation, error) {
+		return r.next.InsertUser(ctx, project, instance, user)
+	})
+}
+
+func (r *retrying) InsertBackupRun(ctx context.Context, project, instance string, run *sqladmin.BackupRun) (*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "backupRuns.insert", notIdempotent, func() (*sqladmin.Operation, error) {
+		return r.next.InsertBackupRun(ctx, project, instance, run)
+	})
+}
+
+func (r *retrying) ListBackupRuns(ctx context.Context, project, instance string) ([]*sqladmin.BackupRun, error) {
+	return retryCall(ctx, r, "backupRuns.list", idempotent, func() ([]*sqladmin.BackupRun, error) {
+		return r.next.ListBackupRuns(ctx, project, instance)
+	})
+}
+
+func (r *retrying) DeleteBackupRun(ctx context.Context, project, instance string, id int64) (*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "backupRuns.delete", notIdempotent, func() (*sqladmin.Operation, error) {
+		return r.next.DeleteBackupRun(ctx, project, instance, id)
+	})
+}
+
+func (r *retrying) GetOperation(ctx context.Context, project, operation string) (*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "operations.get", idempotent, func() (*sqladmin.Operation, error) {
+		return r.next.GetOperation(ctx, project, operation)
+	})
+}
+
+func (r *retrying) ListOperations(ctx context.Context, project, instance string) ([]*sqladmin.Operation, error) {
+	return retryCall(ctx, r, "operations.list", idempotent, func() ([]*sqladmin.Operation, error) {
+		return r.next.ListOperations(ctx, project, instance)
+	})
+}
+
+func (r *retrying) CancelOperation(ctx context.Context, project, operation string) error {
+	_, err := retryCall(ctx, r, "operations.cancel", idempotent, func() (struct{}, error) {
+		return struct{}{}, r.next.CancelOperation(ctx, project, operation)
+	})
+	return err
+}
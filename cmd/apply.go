@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/engine"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/spec"
+)
+
+var ApplyCmd = &cobra.Command{
+	Use:   "apply -f FILE...",
+	Short: "Create or update instances to match declarative spec files",
+	Long: `Apply reads instance specs and makes Cloud SQL match them: a missing
+instance is created, an existing one is patched with only the fields that
+differ, and missing databases and users are added. Fields a spec leaves out,
+and database flags, labels, databases or users it does not list, are left
+alone. Every operation is waited for before the next one starts.`,
+	RunE: runApply,
+}
+
+func init() {
+	ApplyCmd.Flags().StringSliceP("filename", "f", nil, "Instance spec YAML file (repeatable)")
+	ApplyCmd.Flags().Duration("timeout", 30*time.Minute, "How long to wait for each operation")
+	ApplyCmd.Flags().Duration("pollInterval", 5*time.Second, "Initial interval for polling operation status (backs off up to 30s)")
+
+	bindFlag("apply.filename", ApplyCmd.Flags().Lookup("filename"))
+	bindFlag("apply.timeout", ApplyCmd.Flags().Lookup("timeout"))
+	bindFlag("apply.pollInterval", ApplyCmd.Flags().Lookup("pollInterval"))
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	specs, err := loadSpecs(listSetting("apply.filename", ","))
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	a := applier{
+		client:   sqlClient,
+		interval: viper.GetDuration("apply.pollInterval"),
+		timeout:  viper.GetDuration("apply.timeout"),
+	}
+	var results applyResults
+	for _, s := range specs {
+		r, err := a.apply(ctx, s)
+		if err != nil {
+			return err
+		}
+		results = append(results, r)
+	}
+	return printResult(results, results.table, "")
+}
+
+// loadSpecs reads and validates every spec file before anything is
+// changed, filling in the global project and region.
+func loadSpecs(files []string) ([]*spec.Instance, error) {
+	if len(files) == 0 {
+		return nil, errkind.Validationf("at least one spec file (-f) is required")
+	}
+	cfg := config.LoadAppConfig()
+	var specs []*spec.Instance
+	for _, file := range files {
+		s, err := spec.LoadInstance(file)
+		if err != nil {
+			return nil, errkind.Validationf("failed to load spec: %v", err)
+		}
+		s.Defaults(cfg.ProjectID, cfg.DefaultRegion)
+		if err := s.Validate(); err != nil {
+			return nil, errkind.Validationf("%s: %v", file, err)
+		}
+		specs = append(specs, s)
+	}
+	return specs, nil
+}
+
+// applyResult is the outcome of applying one spec.
+type applyResult struct {
+	Project    string        `json:"project"`
+	Instance   string        `json:"instance"`
+	Action     string        `json:"action"`
+	Changes    []spec.Change `json:"changes,omitempty"`
+	Databases  []string      `json:"createdDatabases,omitempty"`
+	Users      []string      `json:"createdUsers,omitempty"`
+	Operations []string      `json:"operations,omitempty"`
+}
+
+type applyResults []applyResult
+
+func (rs applyResults) table(wide bool) ([]string, [][]string) {
+	header := []string{"INSTANCE", "ACTION", "CHANGES", "CREATED_DATABASES", "CREATED_USERS"}
+	if wide {
+		header = append(header, "PROJECT", "OPERATIONS")
+	}
+	rows := make([][]string, 0, len(rs))
+	for _, r := range rs {
+		row := []string{r.Instance, r.Action, strconv.Itoa(len(r.Changes)),
+			strings.Join(r.Databases, ","), strings.Join(r.Users, ",")}
+		if wide {
+			row = append(row, r.Project, strings.Join(r.Operations, ","))
+		}
+		rows = append(rows, row)
+	}
+	return header, rows
+}
+
+// applier reconciles instances with their specs, one operation at a time.
+type applier struct {
+	client   client.Client
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func (a applier) apply(ctx context.Context, s *spec.Instance) (applyResult, error) {
+	r := applyResult{Project: s.Project, Instance: s.Name, Action: "unchanged"}
+
+	current, err := a.client.GetInstance(ctx, s.Project, s.Name)
+	switch {
+	case errkind.Is(err, errkind.NotFound):
+		if err := a.create(ctx, s, &r); err != nil {
+			return r, err
+		}
+	case err != nil:
+		return r, fmt.Errorf("failed to get instance %s: %w", s.Name, err)
+	default:
+		if err := a.update(ctx, s, current, &r); err != nil {
+			return r, err
+		}
+	}
+
+	if err := a.ensureDatabases(ctx, s, &r); err != nil {
+		return r, err
+	}
+	if err := a.ensureUsers(ctx, s, &r); err != nil {
+		return r, err
+	}
+	if r.Action == "unchanged" && len(r.Databases)+len(r.Users) > 0 {
+		r.Action = "updated"
+	}
+	log.Printf("Instance %s %s.\n", s.Name, r.Action)
+	return r, nil
+}
+
+func (a applier) create(ctx context.Context, s *spec.Instance, r *applyResult) error {
+	inst, err := s.NewInstance()
+	if err != nil {
+		return errkind.New(errkind.Validation, err)
+	}
+	if inst.RootPassword, err = s.RootPassword(); err != nil {
+		return errkind.New(errkind.Validation, err)
+	}
+	log.Printf("Creating instance %s (%s in %s)...\n", s.Name, s.DatabaseVersion, s.Region)
+	op, err := a.client.InsertInstance(ctx, s.Project, inst)
+	if err != nil {
+		return fmt.Errorf("error creating instance %s: %w", s.Name, err)
+	}
+	done := trackResource(fmt.Sprintf("instance %s in project %s", s.Name, s.Project),
+		fmt.Sprintf("delete instance %s", s.Name),
+		deleteInstanceCleanup(a.client, s.Project, s.Name, op))
+	if err := a.wait(ctx, s.Project, op, r); err != nil {
+		return err
+	}
+	done()
+	r.Action = "created"
+	return nil
+}
+
+func (a applier) update(ctx context.Context, s *spec.Instance, current *sqladmin.DatabaseInstance, r *applyResult) error {
+	desired, err := s.Desired(current)
+	if err != nil {
+		return errkind.New(errkind.Validation, err)
+	}
+	r.Changes = spec.Diff(current, desired)
+	if len(r.Changes) == 0 {
+		return nil
+	}
+	logChanges(fmt.Sprintf("Updating instance %s:", s.Name), r.Changes)
+
+	steps := [][]spec.Change{r.Changes}
+	if from, to := current.DatabaseVersion, desired.DatabaseVersion; from != to {
+		if err := checkUpgrade(current, to, desired.Settings.DatabaseFlags); err != nil {
+			return err
+		}
+		if engine.IsMajorUpgrade(from, to) {
+			// The API rejects a major version upgrade combined with other
+			// changes, so it goes first, on its own.
+			steps = splitChange(r.Changes, "databaseVersion")
+		}
+	}
+	for _, changes := range steps {
+		op, err := a.client.PatchInstance(ctx, s.Project, s.Name, spec.Patch(desired, changes))
+		if err != nil {
+			return fmt.Errorf("error updating instance %s: %w", s.Name, err)
+		}
+		if err := a.wait(ctx, s.Project, op, r); err != nil {
+			return err
+		}
+	}
+	r.Action = "updated"
+	return nil
+}
+
+// splitChange separates the change at path from the others: the result is
+// that change, then the rest if there are any.
+func splitChange(changes []spec.Change, path string) [][]spec.Change {
+	var first, rest []spec.Change
+	for _, c := range changes {
+		if c.Path == path {
+			first = append(first, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	if len(rest) == 0 {
+		return [][]spec.Change{first}
+	}
+	return [][]spec.Change{first, rest}
+}
+
+func (a applier) ensureDatabases(ctx context.Context, s *spec.Instance, r *applyResult) error {
+	if len(s.Databases) == 0 {
+		return nil
+	}
+	existing, err := a.client.ListDatabases(ctx, s.Project, s.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list databases of %s: %w", s.Name, err)
+	}
+	have := map[string]bool{}
+	for _, db := range existing {
+		have[db.Name] = true
+	}
+	for _, db := range s.Databases {
+		if have[db.Name] {
+			continue
+		}
+		log.Printf("Creating database %s on %s...\n", db.Name, s.Name)
+		op, err := a.client.InsertDatabase(ctx, s.Project, s.Name, &sqladmin.Database{
+			Name:      db.Name,
+			Charset:   db.Charset,
+			Collation: db.Collation,
+		})
+		if err != nil {
+			return fmt.Errorf("error creating database %s: %w", db.Name, err)
+		}
+		if err := a.wait(ctx, s.Project, op, r); err != nil {
+			return err
+		}
+		r.Databases = append(r.Databases, db.Name)
+	}
+	return nil
+}
+
+func (a applier) ensureUsers(ctx context.Context, s *spec.Instance, r *applyResult) error {
+	if len(s.Users) == 0 {
+		return nil
+	}
+	existing, err := a.client.ListUsers(ctx, s.Project, s.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list users of %s: %w", s.Name, err)
+	}
+	for _, u := range s.Users {
+		if hasUser(existing, u) {
+			continue
+		}
+		user := &sqladmin.User{Name: u.Name, Host: u.Host, Type: u.Type}
+		if u.PasswordEnv != "" {
+			if user.Password = os.Getenv(u.PasswordEnv); user.Password == "" {
+				return errkind.Validationf("%s: user %s: environment variable %s (passwordEnv) is not set",
+					s.Name, u.Name, u.PasswordEnv)
+			}
+		}
+		log.Printf("Creating user %s on %s...\n", u.Name, s.Name)
+		op, err := a.client.InsertUser(ctx, s.Project, s.Name, user)
+		if err != nil {
+			return fmt.Errorf("error creating user %s: %w", u.Name, err)
+		}
+		if err := a.wait(ctx, s.Project, op, r); err != nil {
+			return err
+		}
+		r.Users = append(r.Users, u.Name)
+	}
+	return nil
+}
+
+// hasUser reports whether u exists. A spec user without a host matches the
+// user of that name on any host, e.g. MySQL's default "%".
+func hasUser(existing []*sqladmin.User, u spec.User) bool {
+	for _, e := range existing {
+		if e.Name == u.Name && (u.Host == "" || e.Host == u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a applier) wait(ctx context.Context, project string, op *sqladmin.Operation, r *applyResult) error {
+	r.Operations = append(r.Operations, op.Name)
+	_, err := waitForOperation(ctx, a.client, project, op, a.interval, a.timeout)
+	return err
+}
@@ -1,13 +1,14 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
 	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
 )
 
 // BackupCmd triggers an on-demand backup for an existing Cloud SQL instance.
@@ -22,36 +23,44 @@ func init() {
 	BackupCmd.Flags().String("instance", "", "Name of the Cloud SQL instance (required)")
 	BackupCmd.Flags().String("description", "on-demand-backup", "Description for this backup")
 
-	viper.BindPFlag("backup.project", BackupCmd.Flags().Lookup("project"))
-	viper.BindPFlag("backup.instance", BackupCmd.Flags().Lookup("instance"))
-	viper.BindPFlag("backup.description", BackupCmd.Flags().Lookup("description"))
+	bindFlag("backup.project", BackupCmd.Flags().Lookup("project"))
+	bindFlag("backup.instance", BackupCmd.Flags().Lookup("instance"))
+	bindFlag("backup.description", BackupCmd.Flags().Lookup("description"))
+
+	addWaitFlags(BackupCmd, "backup")
 
 	// Register BackupCmd with the root command in root.go
 }
 
 func runBackup(cmd *cobra.Command, args []string) error {
-	projectID := viper.GetString("backup.project")
+	cfg := config.LoadAppConfig()
+	projectID := stringSetting("backup.project", cfg.ProjectID)
 	instanceName := viper.GetString("backup.instance")
 	backupDescription := viper.GetString("backup.description")
 
 	if projectID == "" || instanceName == "" {
-		return fmt.Errorf("both --project and --instance are required")
+		return errkind.Validationf("both --project and --instance are required")
 	}
 
-	ctx := context.Background()
-	sqlService, err := sqladmin.NewService(ctx, option.WithScopes(sqladmin.CloudPlatformScope))
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create SQL Admin service: %v", err)
+		return err
 	}
 
 	backupRun := &sqladmin.BackupRun{
 		Description: backupDescription,
 	}
-	op, err := sqlService.BackupRuns.Insert(projectID, instanceName, backupRun).Context(ctx).Do()
+	op, err := sqlClient.InsertBackupRun(ctx, projectID, instanceName, backupRun)
 	if err != nil {
-		return fmt.Errorf("error creating backup for instance %s: %v", instanceName, err)
+		return fmt.Errorf("error creating backup for instance %s: %w", instanceName, err)
 	}
 
 	log.Printf("Backup initiated for instance %s. Operation: %s\n", instanceName, op.Name)
-	return nil
+	op, err = waitIfRequested(ctx, sqlClient, "backup", projectID, op)
+	if err != nil {
+		return err
+	}
+	result := newOperationResult(projectID, instanceName, op)
+	return printResult(result, result.table, "")
 }
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
+)
+
+// ConfigCmd groups the commands that inspect and edit the sledge config file.
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and edit the sledge configuration",
+}
+
+var configUseProfileCmd = &cobra.Command{
+	Use:   "use-profile NAME",
+	Short: "Make NAME the current profile in the config file",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runConfigUseProfile,
+}
+
+var configListProfilesCmd = &cobra.Command{
+	Use:   "list-profiles",
+	Short: "List the profiles defined in the config file",
+	Args:  cobra.NoArgs,
+	RunE:  runConfigListProfiles,
+}
+
+var configCurrentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Print the profile in use",
+	Args:  cobra.NoArgs,
+	RunE:  runConfigCurrent,
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view [KEY...]",
+	Short: "Show the effective value of every setting and where it came from",
+	Long: `Shows the value each setting resolves to after flags, environment
+variables, the active profile, the config file and defaults are merged, and
+which of them it came from. Pass keys to show only those.`,
+	RunE: runConfigView,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file for unknown keys, typos, bad values and missing required values",
+	Args:  cobra.NoArgs,
+	RunE:  runConfigValidate,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Set KEY to VALUE in the config file, keeping its comments",
+	Long: `Sets a key in the config file in place. KEY may be prefixed with
+profiles.NAME. to set it in a profile, e.g.
+
+  sledge config set migrate.pollInterval 10s
+  sledge config set profiles.prod.project_id my-prod-project`,
+	Args: cobra.ExactArgs(2),
+	RunE: runConfigSet,
+}
+
+func init() {
+	ConfigCmd.AddCommand(configUseProfileCmd)
+	ConfigCmd.AddCommand(configListProfilesCmd)
+	ConfigCmd.AddCommand(configCurrentCmd)
+	ConfigCmd.AddCommand(configViewCmd)
+	ConfigCmd.AddCommand(configValidateCmd)
+	ConfigCmd.AddCommand(configSetCmd)
+}
+
+// configFileUsed returns the config file viper read, which is the file the
+// config subcommands edit.
+func configFileUsed() (string, error) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return "", fmt.Errorf("no config file found; create $HOME/.sledge.yaml or pass --config")
+	}
+	return path, nil
+}
+
+func runConfigUseProfile(cmd *cobra.Command, args []string) error {
+	path, err := configFileUsed()
+	if err != nil {
+		return err
+	}
+	name := args[0]
+	if !config.HasProfile(name) {
+		return fmt.Errorf("profile %q is not defined in %s (available: %v)", name, path, config.Profiles())
+	}
+	if err := config.SetFileValue(path, config.KeyCurrentProfile, name); err != nil {
+		return err
+	}
+	log.Printf("Switched to profile %s in %s\n", name, path)
+	return nil
+}
+
+func runConfigListProfiles(cmd *cobra.Command, args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CURRENT\tNAME\tPROJECT\tREGION")
+	for _, name := range config.Profiles() {
+		current := ""
+		if name == config.ActiveProfile() {
+			current = "*"
+		}
+		prefix := config.KeyProfiles + "." + name + "."
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", current, name,
+			viper.GetString(prefix+config.KeyProjectID), viper.GetString(prefix+config.KeyDefaultRegion))
+	}
+	return w.Flush()
+}
+
+func runConfigCurrent(cmd *cobra.Command, args []string) error {
+	if profileErr != nil {
+		return profileErr
+	}
+	if config.ActiveProfile() == "" {
+		return fmt.Errorf("no profile in use; select one with --profile, %s or `sledge config use-profile`", config.ProfileEnv)
+	}
+	fmt.Println(config.ActiveProfile())
+	return nil
+}
+
+func runConfigView(cmd *cobra.Command, args []string) error {
+	settings := knownSettings()
+	if len(args) > 0 {
+		var selected []config.Setting
+		for _, key := range args {
+			s, _, ok := config.Lookup(settings, key)
+			if !ok {
+				return unknownKeyError(settings, key)
+			}
+			selected = append(selected, s)
+		}
+		settings = selected
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, s := range settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, settingValue(s.Key), settingSource(s.Key))
+	}
+	return w.Flush()
+}
+
+// settingValue formats the effective value of key for display.
+func settingValue(key string) string {
+	if _, ok := settingFallbacks[key]; ok {
+		return effectiveValue(key)
+	}
+	switch v := viper.Get(key).(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// settingSource describes where the effective value of key comes from, in
+// viper's order of precedence.
+func settingSource(key string) string {
+	if flag, ok := boundFlags[key]; ok && flag.Changed {
+		return "flag --" + flag.Name
+	}
+	if env := config.EnvVar(key); os.Getenv(env) != "" {
+		return "env " + env
+	}
+	path := viper.ConfigFileUsed()
+	if profile := config.ActiveProfile(); profile != "" && path != "" &&
+		config.KeyLine(path, config.KeyProfiles+"."+profile+"."+key) > 0 {
+		return "profile " + profile
+	}
+	if path != "" && config.KeyLine(path, key) > 0 {
+		return "config file"
+	}
+	if global, ok := settingFallbacks[key]; ok && viper.GetString(global) != "" {
+		return settingSource(global) + " (via " + global + ")"
+	}
+	return "default"
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) error {
+	path, err := configFileUsed()
+	if err != nil {
+		return err
+	}
+	problems, err := config.ValidateFile(path, knownSettings())
+	if err != nil {
+		return err
+	}
+	problems = append(problems, missingRequired(path)...)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+
+	errors := 0
+	for _, p := range problems {
+		if !p.Warning {
+			errors++
+		}
+		fmt.Printf("%s:%d: %s\n", path, p.Line, p)
+	}
+	if errors > 0 {
+		return fmt.Errorf("%s has %d error(s)", path, errors)
+	}
+	log.Printf("%s is valid\n", path)
+	return nil
+}
+
+// missingRequired reports required keys of the command sections present in
+// the config file that resolve to no value, taking global fallbacks, the
+// active profile and the environment into account.
+func missingRequired(path string) []config.Problem {
+	var problems []config.Problem
+	for section, keys := range requiredSettings {
+		line := config.KeyLine(path, section)
+		if line == 0 {
+			continue
+		}
+		for _, key := range keys {
+			if effectiveValue(key) != "" {
+				continue
+			}
+			msg := "required but not set"
+			if global, ok := settingFallbacks[key]; ok {
+				msg += " here or in " + global
+			}
+			problems = append(problems, config.Problem{Line: line, Key: key, Message: msg})
+		}
+	}
+	return problems
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	path, err := configFileUsed()
+	if err != nil {
+		return err
+	}
+	key, value := args[0], args[1]
+
+	// Keys inside a profile take the same values as top-level keys.
+	prefix, settingKey := "", key
+	if parts := strings.SplitN(key, ".", 3); len(parts) == 3 && strings.EqualFold(parts[0], config.KeyProfiles) {
+		prefix, settingKey = config.KeyProfiles+"."+parts[1]+".", parts[2]
+	}
+
+	settings := knownSettings()
+	s, _, ok := config.Lookup(settings, settingKey)
+	if !ok {
+		return unknownKeyError(settings, settingKey)
+	}
+	if strings.HasSuffix(s.Type, "Slice") || strings.HasSuffix(s.Type, "Array") {
+		return fmt.Errorf("%s holds a list; edit %s to set it", s.Key, path)
+	}
+	if err := config.CheckValue(s.Type, value); err != nil {
+		return errkind.Validationf("invalid value for %s: %v", s.Key, err)
+	}
+
+	if err := config.SetFileValue(path, prefix+s.Key, value); err != nil {
+		return err
+	}
+	log.Printf("Set %s to %s in %s\n", prefix+s.Key, value, path)
+	return nil
+}
+
+// unknownKeyError reports a key sledge does not understand, suggesting the
+// closest known key.
+func unknownKeyError(settings []config.Setting, key string) error {
+	if suggestion := config.Suggest(settings, key); suggestion != "" {
+		return errkind.Validationf("unknown config key %q (did you mean %s?)", key, suggestion)
+	}
+	return errkind.Validationf("unknown config key %q; see `sledge config view` for the known keys", key)
+}
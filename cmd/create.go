@@ -1,13 +1,18 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
 	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/engine"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/spec"
 )
 
 var CreateCmd = &cobra.Command{
@@ -20,51 +25,304 @@ func init() {
 	// Flags for creating an instance
 	CreateCmd.Flags().String("project", "", "GCP Project ID (required)")
 	CreateCmd.Flags().String("instance", "", "Name of the new Cloud SQL instance (required)")
-	CreateCmd.Flags().String("tier", "db-f1-micro", "Machine type tier for MySQL (e.g. db-g1-small, db-f1-micro)")
+	CreateCmd.Flags().String("tier", "db-f1-micro", "Machine type tier, e.g. db-g1-small or db-custom-CPU-RAM_MB (default for sqlserver: db-custom-2-7680)")
 	CreateCmd.Flags().String("region", "us-central1", "Region for the instance")
-	CreateCmd.Flags().String("dbVersion", "MYSQL_8_0", "Database version, e.g. MYSQL_5_7 or MYSQL_8_0")
+	CreateCmd.Flags().String("dbVersion", "", "Database version, e.g. MYSQL_8_0, POSTGRES_16 or SQLSERVER_2019_STANDARD (default: the engine's default)")
+	CreateCmd.Flags().String("engine", "", "Database engine: mysql, postgres or sqlserver (default: from --dbVersion, else mysql)")
+	CreateCmd.Flags().String("edition", "", "SQL Server edition: STANDARD, ENTERPRISE, EXPRESS or WEB")
+	CreateCmd.Flags().String("rootPasswordFile", "", "File holding the root user's password (required for sqlserver unless create.rootPassword is set)")
+	CreateCmd.Flags().String("settingsFile", "", "YAML file with instance settings; the flags below override it")
+	CreateCmd.Flags().Int64("storageSize", 0, "Data disk size in GB (default: the API's, 10)")
+	CreateCmd.Flags().String("storageType", "", "Data disk type: SSD or HDD")
+	CreateCmd.Flags().Bool("storageAutoResize", true, "Grow the data disk automatically when it fills up")
+	CreateCmd.Flags().Int64("storageAutoResizeLimit", 0, "Largest size in GB auto-resize may grow the disk to (0 means no limit)")
+	CreateCmd.Flags().String("availabilityType", "", "ZONAL, or REGIONAL for high availability with a standby in a second zone")
+	CreateCmd.Flags().String("zone", "", "Preferred zone for the instance, e.g. us-central1-a")
+	CreateCmd.Flags().String("secondaryZone", "", "Zone for the standby of a REGIONAL instance")
+	CreateCmd.Flags().Bool("backups", false, "Enable automated daily backups")
+	CreateCmd.Flags().String("backupStartTime", "", "UTC start of the backup window, HH:MM")
+	CreateCmd.Flags().Bool("pointInTimeRecovery", false, "Enable point-in-time recovery (binary logs for MySQL); needs --backups")
+	CreateCmd.Flags().Int64("retainedBackups", 0, "Number of automated backups to keep")
+	CreateCmd.Flags().String("maintenanceDay", "", "Day of the weekly maintenance window, MON to SUN")
+	CreateCmd.Flags().Int64("maintenanceHour", 0, "UTC hour the maintenance window starts, 0 to 23")
+	CreateCmd.Flags().StringSlice("databaseFlags", nil, "Database flags as NAME=VALUE, e.g. max_connections=500 (repeatable)")
+	CreateCmd.Flags().StringSlice("labels", nil, "User labels as KEY=VALUE (repeatable)")
+	CreateCmd.Flags().Bool("deletionProtection", false, "Protect the instance against deletion")
 
 	// Bind flags to viper
-	viper.BindPFlag("create.project", CreateCmd.Flags().Lookup("project"))
-	viper.BindPFlag("create.instance", CreateCmd.Flags().Lookup("instance"))
-	viper.BindPFlag("create.tier", CreateCmd.Flags().Lookup("tier"))
-	viper.BindPFlag("create.region", CreateCmd.Flags().Lookup("region"))
-	viper.BindPFlag("create.dbVersion", CreateCmd.Flags().Lookup("dbVersion"))
+	bindFlag("create.project", CreateCmd.Flags().Lookup("project"))
+	bindFlag("create.instance", CreateCmd.Flags().Lookup("instance"))
+	bindFlag("create.tier", CreateCmd.Flags().Lookup("tier"))
+	bindFlag("create.region", CreateCmd.Flags().Lookup("region"))
+	bindFlag("create.dbVersion", CreateCmd.Flags().Lookup("dbVersion"))
+	bindFlag("create.engine", CreateCmd.Flags().Lookup("engine"))
+	bindFlag("create.edition", CreateCmd.Flags().Lookup("edition"))
+	bindFlag("create.rootPasswordFile", CreateCmd.Flags().Lookup("rootPasswordFile"))
+	bindFlag("create.settingsFile", CreateCmd.Flags().Lookup("settingsFile"))
+	bindFlag("create.storageSize", CreateCmd.Flags().Lookup("storageSize"))
+	bindFlag("create.storageType", CreateCmd.Flags().Lookup("storageType"))
+	bindFlag("create.storageAutoResize", CreateCmd.Flags().Lookup("storageAutoResize"))
+	bindFlag("create.storageAutoResizeLimit", CreateCmd.Flags().Lookup("storageAutoResizeLimit"))
+	bindFlag("create.availabilityType", CreateCmd.Flags().Lookup("availabilityType"))
+	bindFlag("create.zone", CreateCmd.Flags().Lookup("zone"))
+	bindFlag("create.secondaryZone", CreateCmd.Flags().Lookup("secondaryZone"))
+	bindFlag("create.backups", CreateCmd.Flags().Lookup("backups"))
+	bindFlag("create.backupStartTime", CreateCmd.Flags().Lookup("backupStartTime"))
+	bindFlag("create.pointInTimeRecovery", CreateCmd.Flags().Lookup("pointInTimeRecovery"))
+	bindFlag("create.retainedBackups", CreateCmd.Flags().Lookup("retainedBackups"))
+	bindFlag("create.maintenanceDay", CreateCmd.Flags().Lookup("maintenanceDay"))
+	bindFlag("create.maintenanceHour", CreateCmd.Flags().Lookup("maintenanceHour"))
+	bindFlag("create.databaseFlags", CreateCmd.Flags().Lookup("databaseFlags"))
+	bindFlag("create.labels", CreateCmd.Flags().Lookup("labels"))
+	bindFlag("create.deletionProtection", CreateCmd.Flags().Lookup("deletionProtection"))
+
+	addNetworkFlags(CreateCmd, "create")
+	addWaitFlags(CreateCmd, "create")
 }
 
 func runCreate(cmd *cobra.Command, args []string) error {
-	projectID := viper.GetString("create.project")
+	cfg := config.LoadAppConfig()
+	projectID := stringSetting("create.project", cfg.ProjectID)
 	instanceName := viper.GetString("create.instance")
-	tier := viper.GetString("create.tier")
-	region := viper.GetString("create.region")
-	dbVersion := viper.GetString("create.dbVersion")
+	region := stringSetting("create.region", cfg.DefaultRegion)
 
 	if projectID == "" || instanceName == "" {
-		return fmt.Errorf("project and instance flags are required")
+		return errkind.Validationf("project and instance flags are required")
 	}
 
-	ctx := context.Background()
+	settings, err := createSettings()
+	if err != nil {
+		return err
+	}
 
+	// Reject engine, version, tier and settings mistakes before calling the API.
+	eng, dbVersion, tier, err := createEngineSettings(settings.Tier)
+	if err != nil {
+		return errkind.New(errkind.Validation, err)
+	}
+	if settings.Network, err = networkSettings("create", projectID, settings.Network); err != nil {
+		return err
+	}
+	if err := settings.Validate(region); err != nil {
+		return errkind.New(errkind.Validation, err)
+	}
+	rootPassword, err := createRootPassword(eng)
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext(cmd)
 
-	sqlService, err := sqladmin.NewService(ctx, option.WithScopes(sqladmin.CloudPlatformScope))
+	sqlClient, err := getClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create sql admin service: %v", err)
+		return err
 	}
 
 	instance := &sqladmin.DatabaseInstance{
 		Name:            instanceName,
 		Region:          region,
 		DatabaseVersion: dbVersion,
+		RootPassword:    rootPassword,
 		Settings: &sqladmin.Settings{
 			Tier: tier,
 		},
 	}
+	settings.ApplyTo(instance.Settings, eng)
+	instance.Settings.Tier = tier
+	if err := spec.CheckIPConfiguration(instance.Settings.IpConfiguration); err != nil {
+		return errkind.New(errkind.Validation, err)
+	}
 
-	op, err := sqlService.Instances.Insert(projectID, instance).Context(ctx).Do()
+	op, err := sqlClient.InsertInstance(ctx, projectID, instance)
 	if err != nil {
-		return fmt.Errorf("error creating instance: %v", err)
+		return fmt.Errorf("error creating instance: %w", err)
 	}
 
 	log.Printf("Creation initiated for instance %s. Operation: %s\n", instanceName, op.Name)
-	return nil
+	if viper.GetBool("create.wait") {
+		done := trackResource(fmt.Sprintf("instance %s in project %s", instanceName, projectID),
+			fmt.Sprintf("delete instance %s", instanceName),
+			deleteInstanceCleanup(sqlClient, projectID, instanceName, op))
+		if op, err = waitIfRequested(ctx, sqlClient, "create", projectID, op); err != nil {
+			return err
+		}
+		done()
+	}
+	result := newOperationResult(projectID, instanceName, op)
+	return printResult(result, result.table, "")
+}
+
+// createEngineSettings resolves the engine, database version and tier of a
+// new instance. The engine comes from --engine or the version's prefix;
+// a version that was not set explicitly takes the engine's default, and a
+// tier the one from the settings file, else the engine's default.
+func createEngineSettings(fileTier string) (engine.Engine, string, string, error) {
+	dbVersion := viper.GetString("create.dbVersion")
+	versionSet := dbVersion != ""
+	tier := viper.GetString("create.tier")
+	tierSet := viper.IsSet("create.tier") && tier != ""
+	edition := viper.GetString("create.edition")
+
+	eng := engine.MySQL
+	var err error
+	switch {
+	case viper.GetString("create.engine") != "":
+		if eng, err = engine.Parse(viper.GetString("create.engine")); err != nil {
+			return "", "", "", err
+		}
+	case versionSet:
+		if eng, err = engine.FromVersion(dbVersion); err != nil {
+			return "", "", "", err
+		}
+	}
+
+	if !versionSet {
+		dbVersion = eng.DefaultVersion()
+		if eng == engine.SQLServer && edition != "" {
+			// Drop the default edition so --edition picks its own.
+			dbVersion = dbVersion[:strings.LastIndex(dbVersion, "_")]
+		}
+	}
+	if dbVersion, err = eng.WithEdition(dbVersion, edition); err != nil {
+		return "", "", "", err
+	}
+	if err := eng.ValidateVersion(dbVersion); err != nil {
+		return "", "", "", err
+	}
+
+	switch {
+	case tierSet:
+	case fileTier != "":
+		tier = fileTier
+	default:
+		tier = eng.DefaultTier()
+	}
+	if err := eng.ValidateTier(tier); err != nil {
+		return "", "", "", err
+	}
+	return eng, dbVersion, tier, nil
+}
+
+// createRootPassword reads the root password from --rootPasswordFile or the
+// create.rootPassword key (e.g. SLEDGE_CREATE_ROOTPASSWORD). SQL Server
+// instances cannot be created without one.
+func createRootPassword(eng engine.Engine) (string, error) {
+	password := viper.GetString("create.rootPassword")
+	if path := viper.GetString("create.rootPasswordFile"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", errkind.Validationf("failed to read root password file: %v", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+	if password == "" && eng == engine.SQLServer {
+		return "", errkind.Validationf("sqlserver instances need a root password: pass --rootPasswordFile or set %s",
+			config.EnvVar("create.rootPassword"))
+	}
+	return password, nil
+}
+
+// createSettings loads --settingsFile, if any, and overrides it with the
+// create.* settings that are set by flag, environment or config file.
+func createSettings() (*spec.Settings, error) {
+	settings := &spec.Settings{}
+	if path := viper.GetString("create.settingsFile"); path != "" {
+		var err error
+		if settings, err = spec.LoadSettings(path); err != nil {
+			return nil, errkind.Validationf("failed to load settings file: %v", err)
+		}
+	}
+
+	if isSet("create.storageSize") {
+		settings.Storage.SizeGB = viper.GetInt64("create.storageSize")
+	}
+	if isSet("create.storageType") {
+		settings.Storage.Type = viper.GetString("create.storageType")
+	}
+	if isSet("create.storageAutoResize") {
+		autoResize := viper.GetBool("create.storageAutoResize")
+		settings.Storage.AutoResize = &autoResize
+	}
+	if isSet("create.storageAutoResizeLimit") {
+		settings.Storage.AutoResizeLimitGB = viper.GetInt64("create.storageAutoResizeLimit")
+	}
+	if isSet("create.availabilityType") {
+		settings.AvailabilityType = viper.GetString("create.availabilityType")
+	}
+	if isSet("create.zone") {
+		settings.Zone = viper.GetString("create.zone")
+	}
+	if isSet("create.secondaryZone") {
+		settings.SecondaryZone = viper.GetString("create.secondaryZone")
+	}
+	if isSet("create.backups") {
+		enabled := viper.GetBool("create.backups")
+		settings.Backup.Enabled = &enabled
+	}
+	if isSet("create.backupStartTime") {
+		settings.Backup.StartTime = viper.GetString("create.backupStartTime")
+	}
+	if isSet("create.pointInTimeRecovery") {
+		pitr := viper.GetBool("create.pointInTimeRecovery")
+		settings.Backup.PointInTimeRecovery = &pitr
+	}
+	if isSet("create.retainedBackups") {
+		settings.Backup.RetainedBackups = viper.GetInt64("create.retainedBackups")
+	}
+	if isSet("create.maintenanceDay") {
+		settings.Maintenance.Day = viper.GetString("create.maintenanceDay")
+	}
+	if isSet("create.maintenanceHour") {
+		hour := viper.GetInt64("create.maintenanceHour")
+		settings.Maintenance.Hour = &hour
+	}
+	if isSet("create.deletionProtection") {
+		protect := viper.GetBool("create.deletionProtection")
+		settings.DeletionProtection = &protect
+	}
+
+	flags, err := parseKeyValues("database flag", listSetting("create.databaseFlags", ","))
+	if err != nil {
+		return nil, err
+	}
+	labels, err := parseKeyValues("label", listSetting("create.labels", ","))
+	if err != nil {
+		return nil, err
+	}
+	settings.Flags = mergeMaps(settings.Flags, flags)
+	settings.Labels = mergeMaps(settings.Labels, labels)
+	return settings, nil
+}
+
+// isSet reports whether key has a non-empty value from a flag, the
+// environment or the config file, rather than its flag default.
+func isSet(key string) bool {
+	return viper.IsSet(key) && viper.GetString(key) != ""
+}
+
+// parseKeyValues parses KEY=VALUE pairs.
+func parseKeyValues(what string, pairs []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, errkind.Validationf("invalid %s %q, want KEY=VALUE", what, pair)
+		}
+		values[k] = v
+	}
+	return values, nil
+}
+
+// mergeMaps returns base with the entries of overrides added or replaced.
+func mergeMaps(base, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+	if base == nil {
+		base = map[string]string{}
+	}
+	for k, v := range overrides {
+		base[k] = v
+	}
+	return base
 }
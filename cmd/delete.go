@@ -1,13 +1,13 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
-	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
 )
 
 // DeleteCmd removes an existing Cloud SQL instance
@@ -21,31 +21,39 @@ func init() {
 	DeleteCmd.Flags().String("project", "", "GCP Project ID (required)")
 	DeleteCmd.Flags().String("instance", "", "Name of the Cloud SQL instance to delete (required)")
 
-	viper.BindPFlag("delete.project", DeleteCmd.Flags().Lookup("project"))
-	viper.BindPFlag("delete.instance", DeleteCmd.Flags().Lookup("instance"))
+	bindFlag("delete.project", DeleteCmd.Flags().Lookup("project"))
+	bindFlag("delete.instance", DeleteCmd.Flags().Lookup("instance"))
+
+	addWaitFlags(DeleteCmd, "delete")
 }
 
 func runDelete(cmd *cobra.Command, args []string) error {
-	projectID := viper.GetString("delete.project")
+	cfg := config.LoadAppConfig()
+	projectID := stringSetting("delete.project", cfg.ProjectID)
 	instanceName := viper.GetString("delete.instance")
 
 	if projectID == "" || instanceName == "" {
-		return fmt.Errorf("both --project and --instance flags are required")
+		return errkind.Validationf("both --project and --instance flags are required")
 	}
 
 	// Create a context and the SQL Admin service
-	ctx := context.Background()
-	sqlService, err := sqladmin.NewService(ctx, option.WithScopes(sqladmin.CloudPlatformScope))
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create sql admin service: %v", err)
+		return err
 	}
 
 	// Attempt to delete the Cloud SQL instance
-	op, err := sqlService.Instances.Delete(projectID, instanceName).Context(ctx).Do()
+	op, err := sqlClient.DeleteInstance(ctx, projectID, instanceName)
 	if err != nil {
-		return fmt.Errorf("error deleting instance %s: %v", instanceName, err)
+		return fmt.Errorf("error deleting instance %s: %w", instanceName, err)
 	}
 
 	log.Printf("Deletion initiated for instance %s. Operation: %s\n", instanceName, op.Name)
-	return nil
+	op, err = waitIfRequested(ctx, sqlClient, "delete", projectID, op)
+	if err != nil {
+		return err
+	}
+	result := newOperationResult(projectID, instanceName, op)
+	return printResult(result, result.table, "")
 }
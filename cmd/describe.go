@@ -1,20 +1,21 @@
 package cmd
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
-	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/output"
 )
 
-// describeCmd retrieves details about a Cloud SQL instance in pure JSON
+// describeCmd retrieves details about a Cloud SQL instance, as pure JSON
+// unless --output asks for another format
 var describeCmd = &cobra.Command{
 	Use:   "describe",
-	Short: "Describe a Cloud SQL instance (outputs valid JSON only)",
+	Short: "Describe a Cloud SQL instance (JSON by default, see --output)",
 	RunE:  runDescribe,
 }
 
@@ -22,38 +23,32 @@ func init() {
 	describeCmd.Flags().String("project", "", "GCP Project ID (required)")
 	describeCmd.Flags().String("instance", "", "Name of the Cloud SQL instance (required)")
 
-	viper.BindPFlag("describe.project", describeCmd.Flags().Lookup("project"))
-	viper.BindPFlag("describe.instance", describeCmd.Flags().Lookup("instance"))
+	bindFlag("describe.project", describeCmd.Flags().Lookup("project"))
+	bindFlag("describe.instance", describeCmd.Flags().Lookup("instance"))
 }
 
-// runDescribe strictly prints JSON so that callers (e.g., a K8s operator) can parse it 
+// runDescribe strictly prints JSON (or the --output format) so that callers (e.g., a K8s operator) can parse it
 func runDescribe(cmd *cobra.Command, args []string) error {
-	projectID := viper.GetString("describe.project")
+	cfg := config.LoadAppConfig()
+	projectID := stringSetting("describe.project", cfg.ProjectID)
 	instanceName := viper.GetString("describe.instance")
 
 	if projectID == "" || instanceName == "" {
-		return fmt.Errorf("both --project and --instance flags are required")
+		return errkind.Validationf("both --project and --instance flags are required")
 	}
 
-	ctx := context.Background()
-	sqlService, err := sqladmin.NewService(ctx, option.WithScopes(sqladmin.CloudPlatformScope))
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create sql admin service: %v", err)
+		return err
 	}
 
 	// Retrieve instance details from GCP
-	inst, err := sqlService.Instances.Get(projectID, instanceName).Context(ctx).Do()
+	inst, err := sqlClient.GetInstance(ctx, projectID, instanceName)
 	if err != nil {
-		return fmt.Errorf("error describing instance %s: %v", instanceName, err)
-	}
-
-	// Marshal the entire struct to JSON
-	data, marshalErr := json.MarshalIndent(inst, "", "  ")
-	if marshalErr != nil {
-		return fmt.Errorf("failed to marshal instance details: %v", marshalErr)
+		return fmt.Errorf("error describing instance %s: %w", instanceName, err)
 	}
 
 	// Print JSON without additional text/log lines
-	fmt.Println(string(data))
-	return nil
+	return printResult(inst, instanceTable(inst), output.JSON)
 }
\ No newline at end of file
@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/engine"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/output"
+	"github.com/code4bread/sledge/spec"
+)
+
+// Drift statuses.
+const (
+	driftInSync    = "in-sync"
+	driftDrifted   = "drifted"
+	driftMissing   = "missing"
+	driftUnmanaged = "unmanaged"
+	driftError     = "error"
+)
+
+var DriftCmd = &cobra.Command{
+	Use:   "drift [-f FILE...] [--project P...] [--label KEY=VALUE...]",
+	Short: "Report instances whose live settings differ from their spec or the config defaults",
+	Long: `Drift compares live instances with what they should be and reports every
+field that differs, e.g. a tier or flag changed in the console.
+
+With spec files (-f), the instances they name are checked against them. With
+--label, or without spec files, the instances of --project (or the projects
+key, or project_id) matching the labels are scanned; each is checked against
+the spec file naming it, if any, and otherwise against the create defaults of
+the config file (create.tier, create.databaseFlags, create.backups, ...).
+Spec files naming an instance the scan did not find are reported as missing.
+
+Nothing is changed. Drift exits with code 10 (ChangesPending) when any
+instance drifted or is missing, so it can run as a scheduled job.`,
+	Args: cobra.NoArgs,
+	RunE: runDrift,
+}
+
+func init() {
+	DriftCmd.Flags().StringSliceP("filename", "f", nil, "Instance spec YAML file (repeatable)")
+	DriftCmd.Flags().StringSlice("project", nil, "GCP Project IDs to scan, e.g. a,b,c")
+	DriftCmd.Flags().StringSlice("label", nil, "Scan instances with these user labels, as key=value or key")
+
+	bindFlag("drift.filename", DriftCmd.Flags().Lookup("filename"))
+	bindFlag("drift.project", DriftCmd.Flags().Lookup("project"))
+	bindFlag("drift.label", DriftCmd.Flags().Lookup("label"))
+}
+
+func runDrift(cmd *cobra.Command, args []string) error {
+	var specs []*spec.Instance
+	if files := listSetting("drift.filename", ","); len(files) > 0 {
+		var err error
+		if specs, err = loadSpecs(files); err != nil {
+			return err
+		}
+	}
+	labels, err := parseLabels(listSetting("drift.label", ","))
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	var results driftResults
+	if len(specs) > 0 && len(labels) == 0 {
+		for _, s := range specs {
+			r, err := driftFromSpec(ctx, sqlClient, s)
+			if err != nil {
+				return err
+			}
+			results = append(results, r)
+		}
+	} else if results, err = scanDrift(ctx, sqlClient, specs, labels); err != nil {
+		return err
+	}
+
+	if err := printResult(results, results.table, output.Table); err != nil {
+		return err
+	}
+	if n := results.drifted(); n > 0 {
+		return errkind.New(errkind.ChangesPending, fmt.Errorf("%d of %d instance(s) drifted", n, len(results)))
+	}
+	return nil
+}
+
+// driftFromSpec checks the instance a spec file names.
+func driftFromSpec(ctx context.Context, c client.Client, s *spec.Instance) (driftResult, error) {
+	r := driftResult{Project: s.Project, Instance: s.Name, Source: "spec"}
+	current, err := c.GetInstance(ctx, s.Project, s.Name)
+	switch {
+	case errkind.Is(err, errkind.NotFound):
+		r.Status = driftMissing
+		return r, nil
+	case err != nil:
+		return r, fmt.Errorf("failed to get instance %s: %w", s.Name, err)
+	}
+	return r, r.check(ctx, c, s, current)
+}
+
+// scanDrift checks every instance of the scanned projects that has the
+// labels against its spec, or against the config defaults when no spec
+// names it. Specs naming an instance the scan did not find, because it does
+// not exist or no longer has the labels, are reported as missing.
+func scanDrift(ctx context.Context, c client.Client, specs []*spec.Instance, labels map[string]string) (driftResults, error) {
+	projects := listProjects("drift.project")
+	if len(projects) == 0 {
+		return nil, errkind.Validationf("--project flag is required (or set projects or project_id in the config file)")
+	}
+	base, hasBase, err := driftBaseline()
+	if err != nil {
+		return nil, err
+	}
+	if !hasBase && len(specs) == 0 {
+		return nil, errkind.Validationf("nothing to compare against: pass spec files (-f) or set create defaults in the config file")
+	}
+	bySpec := map[string]*spec.Instance{}
+	for _, s := range specs {
+		bySpec[s.Project+"/"+s.Name] = s
+	}
+
+	instances, failed, firstErr := listAllInstances(ctx, c, projects, instanceFilter{labels: labels})
+	if firstErr != nil {
+		return nil, fmt.Errorf("failed to list instances in %d of %d project(s): %w", failed, len(projects), firstErr)
+	}
+	results := make(driftResults, 0, len(instances))
+	for _, inst := range instances {
+		r := driftResult{Project: inst.Project, Instance: inst.Name, Status: driftUnmanaged}
+		s, ok := bySpec[inst.Project+"/"+inst.Name]
+		switch {
+		case ok:
+			r.Source = "spec"
+			delete(bySpec, inst.Project+"/"+inst.Name)
+		case hasBase && base.appliesTo(inst):
+			r.Source = "config"
+			s = base.forInstance(inst)
+		}
+		if s != nil {
+			if err := r.check(ctx, c, s, inst); err != nil {
+				// One bad instance should not hide the drift of the others.
+				log.Errorf("Failed to check instance %s in project %s: %v\n", inst.Name, inst.Project, err)
+				r.Status = driftError
+			}
+		}
+		results = append(results, r)
+	}
+	for _, s := range specs {
+		if _, ok := bySpec[s.Project+"/"+s.Name]; ok {
+			results = append(results, driftResult{Project: s.Project, Instance: s.Name, Status: driftMissing, Source: "spec"})
+		}
+	}
+	return results, nil
+}
+
+// driftDefaults is the state the config file's create defaults describe.
+type driftDefaults struct {
+	// engine is the engine of create.engine or create.dbVersion, "" when
+	// neither is set; instances of other engines have no defaults.
+	engine    engine.Engine
+	dbVersion string
+	settings  spec.Settings
+}
+
+// driftBaseline reads the create defaults; ok is false when none are set.
+// Only values from the config file or environment count, not flag
+// defaults, so unset defaults are never reported as drift.
+func driftBaseline() (d driftDefaults, ok bool, err error) {
+	settings, err := createSettings()
+	if err != nil {
+		return d, false, err
+	}
+	if isSet("create.tier") {
+		settings.Tier = viper.GetString("create.tier")
+	}
+	if settings.Network, err = networkSettings("create", "", settings.Network); err != nil {
+		return d, false, err
+	}
+	d.settings = *settings
+	if isSet("create.dbVersion") {
+		d.dbVersion = viper.GetString("create.dbVersion")
+		if d.engine, err = engine.FromVersion(d.dbVersion); err != nil {
+			return d, false, errkind.Validationf("create.dbVersion: %v", err)
+		}
+	}
+	if isSet("create.engine") {
+		if d.engine, err = engine.Parse(viper.GetString("create.engine")); err != nil {
+			return d, false, errkind.Validationf("create.engine: %v", err)
+		}
+	}
+	return d, d.dbVersion != "" || !reflect.ValueOf(d.settings).IsZero(), nil
+}
+
+func (d driftDefaults) appliesTo(inst *sqladmin.DatabaseInstance) bool {
+	if d.engine == "" {
+		return true
+	}
+	eng, err := engine.FromVersion(inst.DatabaseVersion)
+	return err == nil && eng == d.engine
+}
+
+// forInstance returns the defaults as a spec for inst.
+func (d driftDefaults) forInstance(inst *sqladmin.DatabaseInstance) *spec.Instance {
+	s := &spec.Instance{
+		Name:            inst.Name,
+		Project:         inst.Project,
+		DatabaseVersion: d.dbVersion,
+		Settings:        d.settings,
+	}
+	s.Settings.Network.PrivateNetwork = spec.NetworkPath(inst.Project, s.Settings.Network.PrivateNetwork)
+	return s
+}
+
+// driftResult is how one live instance compares with what it should be.
+// Old values of its changes are live, New values are expected.
+type driftResult struct {
+	Project  string        `json:"project"`
+	Instance string        `json:"instance"`
+	Status   string        `json:"status"`
+	Source   string        `json:"source,omitempty"`
+	Changes  []spec.Change `json:"changes,omitempty"`
+}
+
+func (r *driftResult) check(ctx context.Context, c client.Client, s *spec.Instance, current *sqladmin.DatabaseInstance) error {
+	changes, err := specChanges(ctx, c, s, current)
+	if err != nil {
+		return err
+	}
+	r.Changes, r.Status = changes, driftInSync
+	if len(changes) > 0 {
+		r.Status = driftDrifted
+	}
+	return nil
+}
+
+type driftResults []driftResult
+
+// drifted counts the instances that drifted, are missing or could not be
+// checked.
+func (rs driftResults) drifted() int {
+	n := 0
+	for _, r := range rs {
+		if r.Status == driftDrifted || r.Status == driftMissing || r.Status == driftError {
+			n++
+		}
+	}
+	return n
+}
+
+// table has a row per drifted field; other instances get a single row.
+func (rs driftResults) table(wide bool) ([]string, [][]string) {
+	header := []string{"INSTANCE", "STATUS", "PATH", "LIVE", "EXPECTED"}
+	if wide {
+		header = append(header, "PROJECT", "SOURCE")
+	}
+	var rows [][]string
+	for _, r := range rs {
+		changes := r.Changes
+		if len(changes) == 0 {
+			changes = []spec.Change{{}}
+		}
+		for _, c := range changes {
+			row := []string{r.Instance, r.Status, c.Path, "", ""}
+			if c.Path != "" {
+				row[3], row[4] = spec.FormatValue(c.Old), spec.FormatValue(c.New)
+			}
+			if wide {
+				row = append(row, r.Project, r.Source)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return header, rows
+}
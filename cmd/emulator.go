@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/code4bread/sledge/emulator"
+)
+
+// EmulatorCmd serves a local fake of the Cloud SQL Admin API.
+var EmulatorCmd = &cobra.Command{
+	Use:   "emulator",
+	Short: "Run a local Cloud SQL Admin API emulator",
+	Long: `Serves an in-memory (or file-backed) fake of the Cloud SQL Admin API v1
+endpoints sledge uses. Point other sledge commands at it with --endpoint.
+
+Operations move PENDING -> RUNNING -> DONE on the --pendingFor/--runningFor
+schedule. Errors can be injected with --fault, e.g.
+
+  --fault 'instances.restoreBackup=400:not supported for cross region'
+  --fault 'backupRuns.insert/my-instance*1=op:backup failed'`,
+	RunE: runEmulator,
+}
+
+func init() {
+	EmulatorCmd.Flags().String("addr", "127.0.0.1:8080", "Address to listen on")
+	EmulatorCmd.Flags().String("stateFile", "", "File to persist emulator state in (default in-memory)")
+	EmulatorCmd.Flags().Duration("pendingFor", 1*time.Second, "How long operations stay PENDING")
+	EmulatorCmd.Flags().Duration("runningFor", 3*time.Second, "How long operations stay RUNNING before DONE")
+	EmulatorCmd.Flags().StringArray("fault", nil, "Inject an error: method[/instance][*times]=code:message or method=op:message")
+
+	bindFlag("emulator.addr", EmulatorCmd.Flags().Lookup("addr"))
+	bindFlag("emulator.stateFile", EmulatorCmd.Flags().Lookup("stateFile"))
+	bindFlag("emulator.pendingFor", EmulatorCmd.Flags().Lookup("pendingFor"))
+	bindFlag("emulator.runningFor", EmulatorCmd.Flags().Lookup("runningFor"))
+	bindFlag("emulator.fault", EmulatorCmd.Flags().Lookup("fault"))
+}
+
+func runEmulator(cmd *cobra.Command, args []string) error {
+	addr := viper.GetString("emulator.addr")
+	opts := emulator.Options{
+		StateFile:  viper.GetString("emulator.stateFile"),
+		PendingFor: viper.GetDuration("emulator.pendingFor"),
+		RunningFor: viper.GetDuration("emulator.runningFor"),
+	}
+	for _, spec := range listSetting("emulator.fault", ";") {
+		f, err := emulator.ParseFault(spec)
+		if err != nil {
+			return err
+		}
+		opts.Faults = append(opts.Faults, f)
+	}
+
+	srv, err := emulator.New(opts)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Addr: addr, Handler: srv}
+	ctx := commandContext(cmd)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		// Ctrl-C stops accepting requests and lets those in progress finish.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Cloud SQL Admin API emulator listening on http://%s/ (use --endpoint http://%s/)\n", addr, addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("emulator stopped: %w", err)
+	}
+	<-stopped
+	log.Printf("Emulator stopped.\n")
+	return nil
+}
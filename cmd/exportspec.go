@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/output"
+	"github.com/code4bread/sledge/spec"
+)
+
+var ExportSpecCmd = &cobra.Command{
+	Use:   "export-spec",
+	Short: "Print a live instance as a minimal spec for apply (YAML by default, see --output)",
+	Long: `Export-spec reads an instance with its databases and users and prints the
+spec that describes it, ready for sledge apply, plan and drift. Read-only and
+server-managed fields (etag, ipAddresses, serverCaCert, settingsVersion, ...),
+API defaults and the databases and users Cloud SQL creates itself are left
+out, so applying the spec to the same instance changes nothing.
+
+Passwords cannot be exported: built-in users, and the root user of SQL Server,
+get a passwordEnv placeholder naming the environment variable to set.`,
+	Args: cobra.NoArgs,
+	RunE: runExportSpec,
+}
+
+func init() {
+	ExportSpecCmd.Flags().String("project", "", "GCP Project ID (required)")
+	ExportSpecCmd.Flags().String("instance", "", "Name of the Cloud SQL instance (required)")
+
+	bindFlag("exportSpec.project", ExportSpecCmd.Flags().Lookup("project"))
+	bindFlag("exportSpec.instance", ExportSpecCmd.Flags().Lookup("instance"))
+}
+
+func runExportSpec(cmd *cobra.Command, args []string) error {
+	cfg := config.LoadAppConfig()
+	projectID := stringSetting("exportSpec.project", cfg.ProjectID)
+	instanceName := viper.GetString("exportSpec.instance")
+	if projectID == "" || instanceName == "" {
+		return errkind.Validationf("both --project and --instance flags are required")
+	}
+	format, err := output.Parse(viper.GetString("output"))
+	if err != nil {
+		return errkind.Validationf("invalid --output: %v", err)
+	}
+	switch format.Name {
+	case output.Table, output.Wide, output.CSV:
+		return errkind.Validationf("export-spec prints a spec, not a table: use -o yaml, json or template=...")
+	}
+
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	inst, err := sqlClient.GetInstance(ctx, projectID, instanceName)
+	if err != nil {
+		return fmt.Errorf("error getting instance %s: %w", instanceName, err)
+	}
+	if inst.Project == "" {
+		inst.Project = projectID
+	}
+	databases, err := sqlClient.ListDatabases(ctx, projectID, instanceName)
+	if err != nil {
+		return fmt.Errorf("failed to list databases of %s: %w", instanceName, err)
+	}
+	users, err := sqlClient.ListUsers(ctx, projectID, instanceName)
+	if err != nil {
+		return fmt.Errorf("failed to list users of %s: %w", instanceName, err)
+	}
+
+	s := spec.Export(inst, databases, users)
+	if err := s.Validate(); err != nil {
+		log.Warnf("The exported spec needs editing before it can be applied: %v\n", err)
+	}
+	if format.Name == output.Template {
+		return printResult(s, nil, output.YAML)
+	}
+	// Encode the spec itself rather than its JSON form, so that empty
+	// sections such as backup: {} are left out; JSON is converted from it.
+	var node yaml.Node
+	if err := node.Encode(s); err != nil {
+		return fmt.Errorf("failed to encode spec: %v", err)
+	}
+	var buf bytes.Buffer
+	if format.Name == output.JSON {
+		var compact bytes.Buffer
+		if err := writeJSONNode(&compact, &node); err != nil {
+			return fmt.Errorf("failed to encode spec: %v", err)
+		}
+		if err := json.Indent(&buf, compact.Bytes(), "", "  "); err != nil {
+			return fmt.Errorf("failed to encode spec: %v", err)
+		}
+		buf.WriteByte('\n')
+	} else {
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return fmt.Errorf("failed to encode spec: %v", err)
+		}
+		enc.Close()
+	}
+	_, err = os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// writeJSONNode writes a YAML node as compact JSON, keeping the order of
+// mapping keys.
+func writeJSONNode(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return writeJSONNode(buf, n.Content[0])
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(n.Content[i].Value)
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSONNode(buf, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, c := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONNode(buf, c); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	default:
+		return fmt.Errorf("unexpected YAML node kind %d", n.Kind)
+	}
+	return nil
+}
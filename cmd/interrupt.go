@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/errkind"
+)
+
+// ErrInterrupted is returned by Execute when SIGINT or SIGTERM stopped the command.
+var ErrInterrupted = errkind.ErrInterrupted
+
+// ExitInterrupted is the exit code used when a command was interrupted.
+var ExitInterrupted = errkind.Interrupted.ExitCode()
+
+// cleanupGrace is how long sledge waits for a second Ctrl-C before exiting
+// without cleaning up.
+const cleanupGrace = 10 * time.Second
+
+// ExitCode maps an error returned by Execute to the process exit code; see
+// the errkind package for the table.
+func ExitCode(err error) int {
+	return errkind.ExitCode(err)
+}
+
+// inFlightItem is something a command started and has not yet seen finish.
+type inFlightItem struct {
+	id          int
+	description string
+	// cleanupDesc and cleanup undo a partially created resource; both are
+	// empty for work that cannot or should not be undone.
+	cleanupDesc string
+	cleanup     func(ctx context.Context) error
+}
+
+// inFlightTracker records in-flight work so that an interrupt can report it.
+type inFlightTracker struct {
+	mu     sync.Mutex
+	nextID int
+	items  []*inFlightItem
+}
+
+var inFlight = &inFlightTracker{}
+
+// add records an item and returns a function that removes it again.
+func (t *inFlightTracker) add(item *inFlightItem) (done func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextID++
+	item.id = t.nextID
+	t.items = append(t.items, item)
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for i, it := range t.items {
+			if it.id == item.id {
+				t.items = append(t.items[:i], t.items[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (t *inFlightTracker) snapshot() []*inFlightItem {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*inFlightItem(nil), t.items...)
+}
+
+// trackOperation records a running Cloud SQL operation.
+func trackOperation(projectID string, op *sqladmin.Operation) (done func()) {
+	return inFlight.add(&inFlightItem{
+		description: fmt.Sprintf("operation %s (%s) on instance %s in project %s; follow it with `sledge operations wait --project %s %s`",
+			op.Name, op.OperationType, op.TargetId, projectID, projectID, op.Name),
+	})
+}
+
+// trackResource records a resource that is only partially set up and the
+// cleanup that removes it.
+func trackResource(description, cleanupDesc string, cleanup func(ctx context.Context) error) (done func()) {
+	return inFlight.add(&inFlightItem{description: description, cleanupDesc: cleanupDesc, cleanup: cleanup})
+}
+
+// commandContext returns the context cobra passed to cmd, falling back to
+// context.Background when the command is run directly (e.g. in tests).
+func commandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// executeWithSignals runs the root command, interruptible by SIGINT and
+// SIGTERM.
+func executeWithSignals() error {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	return RunInterruptible(signals, rootCmd.ExecuteContext)
+}
+
+// RunInterruptible runs fn with a context that is cancelled by the first
+// signal received on signals. After an interrupt it reports in-flight work
+// and, with --cleanupOnInterrupt, deletes partially created resources if a
+// second signal arrives within cleanupGrace; the returned error then wraps
+// ErrInterrupted. Execute feeds it SIGINT and SIGTERM; programs embedding
+// sledge, and tests, can feed their own signals.
+func RunInterruptible(signals <-chan os.Signal, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warnf("Received %s, stopping...", sig)
+			close(interrupted)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := fn(ctx)
+	select {
+	case <-interrupted:
+	default:
+		return err
+	}
+
+	items := inFlight.snapshot()
+	reportInFlight(items)
+	if viper.GetBool("cleanupOnInterrupt") {
+		cleanupInFlight(items, signals)
+	}
+	if err == nil {
+		return ErrInterrupted
+	}
+	return fmt.Errorf("%w: %v", ErrInterrupted, err)
+}
+
+func reportInFlight(items []*inFlightItem) {
+	if len(items) == 0 {
+		log.Warn("Nothing was in flight when sledge was interrupted.")
+		return
+	}
+	log.Warn("The following Cloud SQL work was still in flight when sledge was interrupted:")
+	for _, it := range items {
+		if it.cleanupDesc != "" {
+			log.Warnf("  - %s (cleanup: %s)", it.description, it.cleanupDesc)
+		} else {
+			log.Warnf("  - %s", it.description)
+		}
+	}
+}
+
+// cleanupInFlight waits for a second signal and then runs the cleanups of
+// the given items with a fresh context.
+func cleanupInFlight(items []*inFlightItem, signals <-chan os.Signal) {
+	var cleanable []*inFlightItem
+	for _, it := range items {
+		if it.cleanup != nil {
+			cleanable = append(cleanable, it)
+		}
+	}
+	if len(cleanable) == 0 {
+		return
+	}
+
+	log.Warnf("Press Ctrl-C again within %s to clean up partially created resources.", cleanupGrace)
+	select {
+	case <-signals:
+	case <-time.After(cleanupGrace):
+		log.Warn("No second interrupt received; leaving resources in place.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+	for _, it := range cleanable {
+		log.Warnf("Cleaning up: %s", it.cleanupDesc)
+		if err := it.cleanup(ctx); err != nil {
+			log.Errorf("Cleanup of %s failed: %v", it.description, err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/output"
+)
+
+// listConcurrency bounds how many projects are listed at the same time.
+const listConcurrency = 8
+
+// ListCmd inventories the instances of one or more projects.
+var ListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List Cloud SQL instances across one or more projects",
+	Long: `Lists the instances of every given project, optionally filtered. Without
+--project, the projects key of the config file (or profile) is used, then
+project_id. Prints a table by default; see --output for json, yaml, wide and
+csv.`,
+	Args: cobra.NoArgs,
+	RunE: runList,
+}
+
+func init() {
+	ListCmd.Flags().StringSlice("project", nil, "GCP Project IDs to list, e.g. a,b,c")
+	ListCmd.Flags().StringSlice("region", nil, "Only list instances in these regions")
+	ListCmd.Flags().StringSlice("dbVersion", nil, "Only list instances with these database versions, e.g. MYSQL_8_0")
+	ListCmd.Flags().StringSlice("state", nil, "Only list instances in these states, e.g. RUNNABLE,SUSPENDED")
+	ListCmd.Flags().StringSlice("tier", nil, "Only list instances with these machine tiers")
+	ListCmd.Flags().StringSlice("label", nil, "Only list instances with these user labels, as key=value or key")
+
+	bindFlag("list.project", ListCmd.Flags().Lookup("project"))
+	bindFlag("list.region", ListCmd.Flags().Lookup("region"))
+	bindFlag("list.dbVersion", ListCmd.Flags().Lookup("dbVersion"))
+	bindFlag("list.state", ListCmd.Flags().Lookup("state"))
+	bindFlag("list.tier", ListCmd.Flags().Lookup("tier"))
+	bindFlag("list.label", ListCmd.Flags().Lookup("label"))
+}
+
+// instanceFilter selects instances by the list filters. Empty fields match
+// everything.
+type instanceFilter struct {
+	regions, versions, states, tiers []string
+	labels                           map[string]string
+}
+
+func (f instanceFilter) matches(inst *sqladmin.DatabaseInstance) bool {
+	if !matchesAny(inst.Region, f.regions) || !matchesAny(inst.DatabaseVersion, f.versions) ||
+		!matchesAny(inst.State, f.states) || !matchesAny(instanceTier(inst), f.tiers) {
+		return false
+	}
+	var userLabels map[string]string
+	if inst.Settings != nil {
+		userLabels = inst.Settings.UserLabels
+	}
+	for k, v := range f.labels {
+		got, ok := userLabels[k]
+		if !ok || (v != "" && got != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLabels parses key=value (or bare key) label selectors.
+func parseLabels(selectors []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, sel := range selectors {
+		k, v, _ := strings.Cut(sel, "=")
+		if k == "" {
+			return nil, errkind.Validationf("invalid label selector %q, want key=value or key", sel)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// listProjects returns the projects to scan: the command's --project (key),
+// then the projects key, then the global project_id.
+func listProjects(key string) []string {
+	if projects := listSetting(key, ","); len(projects) > 0 {
+		return projects
+	}
+	if projects := listSetting(config.KeyProjects, ","); len(projects) > 0 {
+		return projects
+	}
+	if projectID := config.LoadAppConfig().ProjectID; projectID != "" {
+		return []string{projectID}
+	}
+	return nil
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	projects := listProjects("list.project")
+	if len(projects) == 0 {
+		return errkind.Validationf("--project flag is required (or set projects or project_id in the config file)")
+	}
+	labels, err := parseLabels(listSetting("list.label", ","))
+	if err != nil {
+		return err
+	}
+	filter := instanceFilter{
+		regions:  listSetting("list.region", ","),
+		versions: listSetting("list.dbVersion", ","),
+		states:   listSetting("list.state", ","),
+		tiers:    listSetting("list.tier", ","),
+		labels:   labels,
+	}
+
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	instances, failed, firstErr := listAllInstances(ctx, sqlClient, projects, filter)
+
+	// Print what could be listed even if some projects failed.
+	if err := printResult(instances, instancesTable(instances), output.Table); err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return fmt.Errorf("failed to list instances in %d of %d project(s): %w", failed, len(projects), firstErr)
+	}
+	return nil
+}
+
+// listAllInstances lists the instances of every project concurrently and
+// keeps those matching filter, sorted by project and name. Projects that fail to list are logged and
+// skipped; failed counts them and firstErr is the first of their errors.
+func listAllInstances(ctx context.Context, c client.Client, projects []string, filter instanceFilter) (instances []*sqladmin.DatabaseInstance, failed int, firstErr error) {
+	type projectResult struct {
+		instances []*sqladmin.DatabaseInstance
+		err       error
+	}
+	results := make([]projectResult, len(projects))
+	sem := make(chan struct{}, listConcurrency)
+	var wg sync.WaitGroup
+	for i, project := range projects {
+		wg.Add(1)
+		go func(i int, project string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			instances, err := c.ListInstances(ctx, project)
+			results[i] = projectResult{instances: instances, err: err}
+		}(i, project)
+	}
+	wg.Wait()
+
+	instances = []*sqladmin.DatabaseInstance{}
+	for i, r := range results {
+		if r.err != nil {
+			log.Errorf("Failed to list instances in project %s: %v", projects[i], r.err)
+			failed++
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		for _, inst := range r.instances {
+			if inst.Project == "" {
+				inst.Project = projects[i]
+			}
+			if filter.matches(inst) {
+				instances = append(instances, inst)
+			}
+		}
+	}
+	sort.SliceStable(instances, func(i, j int) bool {
+		if instances[i].Project != instances[j].Project {
+			return instances[i].Project < instances[j].Project
+		}
+		return instances[i].Name < instances[j].Name
+	})
+	return instances, failed, firstErr
+}
+
+// instancesTable renders instances one per row.
+func instancesTable(instances []*sqladmin.DatabaseInstance) output.TableFunc {
+	return func(wide bool) ([]string, [][]string) {
+		header := []string{"PROJECT", "NAME", "REGION", "VERSION", "TIER", "STATE"}
+		if wide {
+			header = append(header, "LABELS", "CONNECTION_NAME", "IP_ADDRESS")
+		}
+		rows := make([][]string, 0, len(instances))
+		for _, inst := range instances {
+			row := []string{inst.Project, inst.Name, inst.Region, inst.DatabaseVersion, instanceTier(inst), inst.State}
+			if wide {
+				row = append(row, formatLabels(inst), inst.ConnectionName, primaryIP(inst))
+			}
+			rows = append(rows, row)
+		}
+		return header, rows
+	}
+}
+
+// formatLabels renders the user labels of an instance as sorted k=v pairs.
+func formatLabels(inst *sqladmin.DatabaseInstance) string {
+	if inst.Settings == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(inst.Settings.UserLabels))
+	for k, v := range inst.Settings.UserLabels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
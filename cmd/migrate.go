@@ -1,15 +1,17 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
 	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/spec"
 )
 
 var MigrateCmd = &cobra.Command{
@@ -25,42 +27,50 @@ func init() {
 	MigrateCmd.Flags().String("targetInstance", "", "Name of the new Cloud SQL instance in target region (required)")
 	MigrateCmd.Flags().String("targetRegion", "", "Region where new instance should live (required)")
 	MigrateCmd.Flags().String("backupDesc", "migration-backup", "Description for the on-demand backup")
-	MigrateCmd.Flags().Duration("pollInterval", 5*time.Second, "Interval for polling operation status")
+	MigrateCmd.Flags().Duration("pollInterval", 5*time.Second, "Initial interval for polling operation status (backs off up to 30s)")
 	MigrateCmd.Flags().Duration("pollTimeout", 10*time.Minute, "Timeout for polling operation completion")
 
-	viper.BindPFlag("migrate.sourceProject", MigrateCmd.Flags().Lookup("sourceProject"))
-	viper.BindPFlag("migrate.sourceInstance", MigrateCmd.Flags().Lookup("sourceInstance"))
-	viper.BindPFlag("migrate.targetProject", MigrateCmd.Flags().Lookup("targetProject"))
-	viper.BindPFlag("migrate.targetInstance", MigrateCmd.Flags().Lookup("targetInstance"))
-	viper.BindPFlag("migrate.targetRegion", MigrateCmd.Flags().Lookup("targetRegion"))
-	viper.BindPFlag("migrate.backupDesc", MigrateCmd.Flags().Lookup("backupDesc"))
-	viper.BindPFlag("migrate.pollInterval", MigrateCmd.Flags().Lookup("pollInterval"))
-	viper.BindPFlag("migrate.pollTimeout", MigrateCmd.Flags().Lookup("pollTimeout"))
+	bindFlag("migrate.sourceProject", MigrateCmd.Flags().Lookup("sourceProject"))
+	bindFlag("migrate.sourceInstance", MigrateCmd.Flags().Lookup("sourceInstance"))
+	bindFlag("migrate.targetProject", MigrateCmd.Flags().Lookup("targetProject"))
+	bindFlag("migrate.targetInstance", MigrateCmd.Flags().Lookup("targetInstance"))
+	bindFlag("migrate.targetRegion", MigrateCmd.Flags().Lookup("targetRegion"))
+	bindFlag("migrate.backupDesc", MigrateCmd.Flags().Lookup("backupDesc"))
+	bindFlag("migrate.pollInterval", MigrateCmd.Flags().Lookup("pollInterval"))
+	bindFlag("migrate.pollTimeout", MigrateCmd.Flags().Lookup("pollTimeout"))
+
+	// The target keeps the source's IP configuration unless overridden.
+	addNetworkFlags(MigrateCmd, "migrate")
 }
 
 func runMigrate(cmd *cobra.Command, args []string) error {
-	sourceProject := viper.GetString("migrate.sourceProject")
+	cfg := config.LoadAppConfig()
+	sourceProject := stringSetting("migrate.sourceProject", cfg.ProjectID)
 	sourceInstance := viper.GetString("migrate.sourceInstance")
 	targetProject := viper.GetString("migrate.targetProject")
 	targetInstance := viper.GetString("migrate.targetInstance")
-	targetRegion := viper.GetString("migrate.targetRegion")
+	targetRegion := stringSetting("migrate.targetRegion", cfg.DefaultRegion)
 	backupDesc := viper.GetString("migrate.backupDesc")
 	pollInterval := viper.GetDuration("migrate.pollInterval")
 	pollTimeout := viper.GetDuration("migrate.pollTimeout")
 
 	if sourceProject == "" || sourceInstance == "" || targetInstance == "" || targetRegion == "" {
-		return fmt.Errorf("sourceProject, sourceInstance, targetInstance, and targetRegion are required")
+		return errkind.Validationf("sourceProject, sourceInstance, targetInstance, and targetRegion are required")
 	}
 
 	// If targetProject isn't provided, default it to sourceProject
 	if targetProject == "" {
 		targetProject = sourceProject
 	}
+	network, err := networkSettings("migrate", targetProject, spec.Network{})
+	if err != nil {
+		return err
+	}
 
-	ctx := context.Background()
-	sqlService, err := sqladmin.NewService(ctx, option.WithScopes(sqladmin.CloudPlatformScope))
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create sql admin service: %v", err)
+		return err
 	}
 
 	//
@@ -71,26 +81,26 @@ func runMigrate(cmd *cobra.Command, args []string) error {
 	backupReq := &sqladmin.BackupRun{
 		Description: backupDesc,
 	}
-	createBackupOp, err := sqlService.BackupRuns.Insert(sourceProject, sourceInstance, backupReq).Context(ctx).Do()
+	createBackupOp, err := sqlClient.InsertBackupRun(ctx, sourceProject, sourceInstance, backupReq)
 	if err != nil {
-		return fmt.Errorf("error creating on-demand backup: %v", err)
+		return fmt.Errorf("error creating on-demand backup: %w", err)
 	}
 	log.Printf("Backup operation started: %s\n", createBackupOp.Name)
 
 	// Optionally poll for completion of backup
-	backupErr := pollOperation(ctx, sqlService, sourceProject, createBackupOp.Name, pollInterval, pollTimeout)
+	_, backupErr := waitForOperation(ctx, sqlClient, sourceProject, createBackupOp, pollInterval, pollTimeout)
 	if backupErr != nil {
-		return fmt.Errorf("backup operation failed or timed out: %v", backupErr)
+		return fmt.Errorf("backup operation failed or timed out: %w", backupErr)
 	}
 	log.Printf("[1/4] Backup complete.\n\n")
 
 	// Retrieve the backupRunId we just created
-	backupRunList, err := sqlService.BackupRuns.List(sourceProject, sourceInstance).Context(ctx).Do()
+	backupRuns, err := sqlClient.ListBackupRuns(ctx, sourceProject, sourceInstance)
 	if err != nil {
-		return fmt.Errorf("failed to list backup runs: %v", err)
+		return fmt.Errorf("failed to list backup runs: %w", err)
 	}
 	var latestBackup *sqladmin.BackupRun
-	for _, br := range backupRunList.Items {
+	for _, br := range backupRuns {
 		if br.Description == backupDesc {
 			latestBackup = br
 			break
@@ -102,13 +112,21 @@ func runMigrate(cmd *cobra.Command, args []string) error {
 
 	log.Printf("Using BackupRunId: %d\n\n", latestBackup.Id)
 
+	// Until the migration completes, the backup and the target instance are
+	// only partially set up; they are reported (and optionally removed) if
+	// sledge is interrupted, and only untracked once the migration succeeds.
+	backupDone := trackResource(
+		fmt.Sprintf("backup run %d of instance %s in project %s", latestBackup.Id, sourceInstance, sourceProject),
+		fmt.Sprintf("delete backup run %d", latestBackup.Id),
+		deleteBackupRunCleanup(sqlClient, sourceProject, sourceInstance, latestBackup.Id))
+
 	//
 	// Step 2: Fetch Source Instance Info
 	//
 	log.Printf("[2/4] Getting source instance info...\n")
-	srcInst, err := sqlService.Instances.Get(sourceProject, sourceInstance).Context(ctx).Do()
+	srcInst, err := sqlClient.GetInstance(ctx, sourceProject, sourceInstance)
 	if err != nil {
-		return fmt.Errorf("failed to get source instance: %v", err)
+		return fmt.Errorf("failed to get source instance: %w", err)
 	}
 	log.Printf("[2/4] Source instance retrieved. DB Version: %s\n\n", srcInst.DatabaseVersion)
 
@@ -122,19 +140,35 @@ func runMigrate(cmd *cobra.Command, args []string) error {
 		Project:         targetProject,
 		Region:          targetRegion,
 		DatabaseVersion: srcInst.DatabaseVersion,
-		Settings:        srcInst.Settings, // replicate same tier, flags, etc.
+		Settings:        spec.CloneInstance(srcInst).Settings, // replicate same tier, flags, etc.
+	}
+	if newInst.Settings == nil {
+		newInst.Settings = &sqladmin.Settings{}
+	}
+	network.ApplyTo(newInst.Settings)
+	if err := spec.CheckIPConfiguration(newInst.Settings.IpConfiguration); err != nil {
+		return errkind.New(errkind.Validation, err)
+	}
+	log.Printf("Target copies the source settings (tier %s, %d database flags).\n",
+		newInst.Settings.Tier, len(newInst.Settings.DatabaseFlags))
+	for _, c := range spec.Diff(srcInst.Settings, newInst.Settings) {
+		log.Printf("  settings.%s\n", c)
 	}
 
-	createInstOp, err := sqlService.Instances.Insert(targetProject, newInst).Context(ctx).Do()
+	createInstOp, err := sqlClient.InsertInstance(ctx, targetProject, newInst)
 	if err != nil {
-		return fmt.Errorf("error creating target instance: %v", err)
+		return fmt.Errorf("error creating target instance: %w", err)
 	}
 	log.Printf("Creation operation started: %s\n", createInstOp.Name)
+	targetDone := trackResource(
+		fmt.Sprintf("target instance %s in project %s", targetInstance, targetProject),
+		fmt.Sprintf("delete instance %s", targetInstance),
+		deleteInstanceCleanup(sqlClient, targetProject, targetInstance, createInstOp))
 
 	// Poll creation
-	createInstErr := pollOperation(ctx, sqlService, targetProject, createInstOp.Name, pollInterval, pollTimeout)
+	_, createInstErr := waitForOperation(ctx, sqlClient, targetProject, createInstOp, pollInterval, pollTimeout)
 	if createInstErr != nil {
-		return fmt.Errorf("instance creation failed or timed out: %v", createInstErr)
+		return fmt.Errorf("instance creation failed or timed out: %w", createInstErr)
 	}
 	log.Printf("[3/4] Target instance created successfully.\n\n")
 
@@ -150,42 +184,32 @@ func runMigrate(cmd *cobra.Command, args []string) error {
 		},
 	}
 
-	restoreOp, err := sqlService.Instances.RestoreBackup(targetProject, targetInstance, restoreReq).Context(ctx).Do()
+	restoreOp, err := sqlClient.RestoreBackup(ctx, targetProject, targetInstance, restoreReq)
 	if err != nil {
 		if strings.Contains(err.Error(), "not supported for cross region") {
-			return fmt.Errorf("cross-region restore may not be supported for your DB version or region: %v", err)
+			return fmt.Errorf("cross-region restore may not be supported for your DB version or region: %w", err)
 		}
-		return fmt.Errorf("failed to restore backup to new instance: %v", err)
+		return fmt.Errorf("failed to restore backup to new instance: %w", err)
 	}
 	log.Printf("Restore operation started: %s\n", restoreOp.Name)
 
-	restoreErr := pollOperation(ctx, sqlService, targetProject, restoreOp.Name, pollInterval, pollTimeout)
+	restoreDone, restoreErr := waitForOperation(ctx, sqlClient, targetProject, restoreOp, pollInterval, pollTimeout)
 	if restoreErr != nil {
-		return fmt.Errorf("restore operation failed or timed out: %v", restoreErr)
+		return fmt.Errorf("restore operation failed or timed out: %w", restoreErr)
 	}
 
+	backupDone()
+	targetDone()
 	log.Printf("[4/4] Migration complete. New instance: %s in region: %s\n", targetInstance, targetRegion)
-	return nil
-}
-
-// pollOperation polls a long-running operation until completion or timeout
-func pollOperation(ctx context.Context, sqlService *sqladmin.Service, projectID, operationName string,
-	interval, timeout time.Duration) error {
-
-	deadline := time.Now().Add(timeout)
-	for time.Now().Before(deadline) {
-		op, err := sqlService.Operations.Get(projectID, operationName).Context(ctx).Do()
-		if err != nil {
-			return fmt.Errorf("failed to get operation %s: %v", operationName, err)
-		}
-		if op.Status == "DONE" {
-			if op.Error != nil && len(op.Error.Errors) > 0 {
-				return fmt.Errorf("operation %s finished with errors: %v", operationName, op.Error.Errors)
-			}
-			return nil
-		}
-		time.Sleep(interval)
-	}
-	return fmt.Errorf("operation %s did not complete before timeout of %s", operationName, timeout)
+	result := migrateResult{
+		SourceProject:  sourceProject,
+		SourceInstance: sourceInstance,
+		TargetProject:  targetProject,
+		TargetInstance: targetInstance,
+		TargetRegion:   targetRegion,
+		BackupRunID:    latestBackup.Id,
+		Operation:      restoreDone.Name,
+		Status:         restoreDone.Status,
+	}
+	return printResult(result, result.table, "")
 }
- 
\ No newline at end of file
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/spec"
+)
+
+// addNetworkFlags registers the private IP, public IP, authorized network
+// and SSL flags on a command that creates an instance and binds them under
+// the command's viper prefix.
+func addNetworkFlags(cmd *cobra.Command, prefix string) {
+	cmd.Flags().String("privateNetwork", "", "VPC network for a private IP: a network name or projects/P/global/networks/N")
+	cmd.Flags().Bool("publicIp", true, "Give the instance a public IPv4 address")
+	cmd.Flags().StringSlice("authorizedNetworks", nil, "IPv4 CIDR ranges allowed to connect to the public IP, e.g. 203.0.113.0/24")
+	cmd.Flags().String("allocatedIpRange", "", "Name of the private services access range to take the private IP from")
+	cmd.Flags().String("sslMode", "", "ALLOW_UNENCRYPTED_AND_ENCRYPTED, ENCRYPTED_ONLY or TRUSTED_CLIENT_CERTIFICATE_REQUIRED")
+
+	bindFlag(prefix+".privateNetwork", cmd.Flags().Lookup("privateNetwork"))
+	bindFlag(prefix+".publicIp", cmd.Flags().Lookup("publicIp"))
+	bindFlag(prefix+".authorizedNetworks", cmd.Flags().Lookup("authorizedNetworks"))
+	bindFlag(prefix+".allocatedIpRange", cmd.Flags().Lookup("allocatedIpRange"))
+	bindFlag(prefix+".sslMode", cmd.Flags().Lookup("sslMode"))
+}
+
+// networkSettings overrides n with the <prefix>.* network settings that are
+// set, expands a bare network name to a network in project (unless project
+// is "") and validates the result.
+func networkSettings(prefix, project string, n spec.Network) (spec.Network, error) {
+	if isSet(prefix + ".privateNetwork") {
+		n.PrivateNetwork = viper.GetString(prefix + ".privateNetwork")
+	}
+	if isSet(prefix + ".publicIp") {
+		publicIP := viper.GetBool(prefix + ".publicIp")
+		n.PublicIP = &publicIP
+	}
+	if cidrs := listSetting(prefix+".authorizedNetworks", ","); len(cidrs) > 0 {
+		n.AuthorizedNetworks = cidrs
+	}
+	if isSet(prefix + ".allocatedIpRange") {
+		n.AllocatedIPRange = viper.GetString(prefix + ".allocatedIpRange")
+	}
+	if isSet(prefix + ".sslMode") {
+		n.SSLMode = viper.GetString(prefix + ".sslMode")
+	}
+	if project != "" {
+		n.PrivateNetwork = spec.NetworkPath(project, n.PrivateNetwork)
+	}
+
+	if err := n.Validate(); err != nil {
+		return n, errkind.New(errkind.Validation, err)
+	}
+	if n.OpenToInternet() {
+		log.Warnf("Authorized networks %v admit every IPv4 address\n", n.AuthorizedNetworks)
+	}
+	return n, nil
+}
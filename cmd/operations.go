@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/output"
+)
+
+// OperationsCmd groups the commands that follow up on Cloud SQL operations
+// started by other sledge commands.
+var OperationsCmd = &cobra.Command{
+	Use:   "operations",
+	Short: "List, inspect, wait for and cancel Cloud SQL operations",
+}
+
+var operationsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List operations of a project or instance (JSON by default, see --output)",
+	Args:  cobra.NoArgs,
+	RunE:  runOperationsList,
+}
+
+var operationsGetCmd = &cobra.Command{
+	Use:   "get OPERATION",
+	Short: "Show a single operation (JSON by default, see --output)",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runOperationsGet,
+}
+
+var operationsWaitCmd = &cobra.Command{
+	Use:   "wait OPERATION",
+	Short: "Block until an operation is DONE and fail if it reports errors",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runOperationsWait,
+}
+
+var operationsCancelCmd = &cobra.Command{
+	Use:   "cancel OPERATION",
+	Short: "Cancel an operation that has not finished yet",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runOperationsCancel,
+}
+
+func init() {
+	operationsListCmd.Flags().String("instance", "", "Only list operations of this instance")
+	operationsListCmd.Flags().StringSlice("type", nil, "Only list operations of these types, e.g. CREATE,BACKUP_VOLUME")
+	operationsListCmd.Flags().StringSlice("status", nil, "Only list operations in these states, e.g. PENDING,RUNNING")
+	bindFlag("operations.instance", operationsListCmd.Flags().Lookup("instance"))
+	bindFlag("operations.type", operationsListCmd.Flags().Lookup("type"))
+	bindFlag("operations.status", operationsListCmd.Flags().Lookup("status"))
+
+	operationsWaitCmd.Flags().Duration("timeout", 10*time.Minute, "How long to wait before giving up")
+	operationsWaitCmd.Flags().Duration("pollInterval", 5*time.Second, "Initial interval for polling operation status (backs off up to 30s)")
+	bindFlag("operations.timeout", operationsWaitCmd.Flags().Lookup("timeout"))
+	bindFlag("operations.pollInterval", operationsWaitCmd.Flags().Lookup("pollInterval"))
+
+	OperationsCmd.AddCommand(operationsListCmd)
+	OperationsCmd.AddCommand(operationsGetCmd)
+	OperationsCmd.AddCommand(operationsWaitCmd)
+	OperationsCmd.AddCommand(operationsCancelCmd)
+}
+
+// operationsProject returns the project for the operations subcommands: the
+// operations.project config key, or the global --project/project_id.
+func operationsProject() (string, error) {
+	projectID := stringSetting("operations.project", config.LoadAppConfig().ProjectID)
+	if projectID == "" {
+		return "", errkind.Validationf("--project flag is required")
+	}
+	return projectID, nil
+}
+
+func runOperationsList(cmd *cobra.Command, args []string) error {
+	projectID, err := operationsProject()
+	if err != nil {
+		return err
+	}
+	instanceName := viper.GetString("operations.instance")
+	types := listSetting("operations.type", ",")
+	statuses := listSetting("operations.status", ",")
+
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	ops, err := sqlClient.ListOperations(ctx, projectID, instanceName)
+	if err != nil {
+		return fmt.Errorf("error listing operations: %w", err)
+	}
+
+	filtered := []*sqladmin.Operation{}
+	for _, op := range ops {
+		if matchesAny(op.OperationType, types) && matchesAny(op.Status, statuses) {
+			filtered = append(filtered, op)
+		}
+	}
+	return printResult(filtered, operationsTable(filtered), output.JSON)
+}
+
+// matchesAny reports whether value equals one of wanted, ignoring case.
+// An empty wanted list matches everything.
+func matchesAny(value string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		if strings.EqualFold(value, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func runOperationsGet(cmd *cobra.Command, args []string) error {
+	projectID, err := operationsProject()
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	op, err := sqlClient.GetOperation(ctx, projectID, args[0])
+	if err != nil {
+		return fmt.Errorf("error getting operation %s: %w", args[0], err)
+	}
+	return printResult(op, operationsTable([]*sqladmin.Operation{op}), output.JSON)
+}
+
+func runOperationsWait(cmd *cobra.Command, args []string) error {
+	projectID, err := operationsProject()
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	op, err := sqlClient.GetOperation(ctx, projectID, args[0])
+	if err != nil {
+		return fmt.Errorf("error getting operation %s: %w", args[0], err)
+	}
+
+	log.Printf("Waiting for operation %s to complete...\n", args[0])
+	op, err = waitForOperation(ctx, sqlClient, projectID, op,
+		viper.GetDuration("operations.pollInterval"), viper.GetDuration("operations.timeout"))
+	if err != nil {
+		return err
+	}
+	log.Printf("Operation %s completed successfully.\n", args[0])
+	return printResult(op, operationsTable([]*sqladmin.Operation{op}), "")
+}
+
+func runOperationsCancel(cmd *cobra.Command, args []string) error {
+	projectID, err := operationsProject()
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := sqlClient.CancelOperation(ctx, projectID, args[0]); err != nil {
+		return fmt.Errorf("error cancelling operation %s: %w", args[0], err)
+	}
+	log.Printf("Cancellation requested for operation %s\n", args[0])
+	return nil
+}
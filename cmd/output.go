@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/spf13/viper"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/output"
+	"github.com/code4bread/sledge/waiter"
+)
+
+// printResult writes a command's result to stdout in the --output format,
+// or in defaultFormat when --output is not given. Commands whose default is
+// "" print nothing unless asked to, leaving only their log lines on stderr.
+func printResult(v interface{}, table output.TableFunc, defaultFormat string) error {
+	f, err := output.Parse(viper.GetString("output"))
+	if err != nil {
+		return err
+	}
+	if f.Name == "" {
+		if defaultFormat == "" {
+			return nil
+		}
+		f, _ = output.Parse(defaultFormat)
+	}
+	return output.Write(os.Stdout, f, v, table)
+}
+
+// operationResult is the result of the commands that start a single
+// operation on an instance.
+type operationResult struct {
+	Project        string `json:"project"`
+	Instance       string `json:"instance"`
+	Operation      string `json:"operation"`
+	OperationType  string `json:"operationType"`
+	Status         string `json:"status"`
+	BackupRunID    int64  `json:"backupRunId,omitempty"`
+	SourceInstance string `json:"sourceInstance,omitempty"`
+}
+
+func newOperationResult(projectID, instanceName string, op *sqladmin.Operation) operationResult {
+	r := operationResult{
+		Project:       projectID,
+		Instance:      instanceName,
+		Operation:     op.Name,
+		OperationType: op.OperationType,
+		Status:        op.Status,
+	}
+	if op.BackupContext != nil {
+		r.BackupRunID = op.BackupContext.BackupId
+	}
+	return r
+}
+
+func (r operationResult) table(wide bool) ([]string, [][]string) {
+	header := []string{"INSTANCE", "OPERATION", "TYPE", "STATUS"}
+	row := []string{r.Instance, r.Operation, r.OperationType, r.Status}
+	if wide {
+		header = append(header, "PROJECT", "BACKUP_RUN_ID", "SOURCE_INSTANCE")
+		row = append(row, r.Project, formatID(r.BackupRunID), r.SourceInstance)
+	}
+	return header, [][]string{row}
+}
+
+// migrateResult is the result of `sledge migrate`.
+type migrateResult struct {
+	SourceProject  string `json:"sourceProject"`
+	SourceInstance string `json:"sourceInstance"`
+	TargetProject  string `json:"targetProject"`
+	TargetInstance string `json:"targetInstance"`
+	TargetRegion   string `json:"targetRegion"`
+	BackupRunID    int64  `json:"backupRunId"`
+	Operation      string `json:"operation"`
+	Status         string `json:"status"`
+}
+
+func (r migrateResult) table(wide bool) ([]string, [][]string) {
+	header := []string{"SOURCE", "TARGET", "TARGET_REGION", "BACKUP_RUN_ID", "STATUS"}
+	row := []string{r.SourceInstance, r.TargetInstance, r.TargetRegion, formatID(r.BackupRunID), r.Status}
+	if wide {
+		header = append(header, "SOURCE_PROJECT", "TARGET_PROJECT", "OPERATION")
+		row = append(row, r.SourceProject, r.TargetProject, r.Operation)
+	}
+	return header, [][]string{row}
+}
+
+// instanceTable renders the concise view of an instance used by describe.
+func instanceTable(inst *sqladmin.DatabaseInstance) output.TableFunc {
+	return func(wide bool) ([]string, [][]string) {
+		header := []string{"NAME", "REGION", "VERSION", "TIER", "STATE"}
+		row := []string{inst.Name, inst.Region, inst.DatabaseVersion, instanceTier(inst), inst.State}
+		if wide {
+			settingsVersion := ""
+			if inst.Settings != nil {
+				settingsVersion = formatID(inst.Settings.SettingsVersion)
+			}
+			header = append(header, "PROJECT", "CONNECTION_NAME", "IP_ADDRESS", "SETTINGS_VERSION")
+			row = append(row, inst.Project, inst.ConnectionName, primaryIP(inst), settingsVersion)
+		}
+		return header, [][]string{row}
+	}
+}
+
+// instanceTier returns the machine tier of an instance, "" if unknown.
+func instanceTier(inst *sqladmin.DatabaseInstance) string {
+	if inst.Settings == nil {
+		return ""
+	}
+	return inst.Settings.Tier
+}
+
+// primaryIP returns the first IP address of an instance, "" if it has none.
+func primaryIP(inst *sqladmin.DatabaseInstance) string {
+	if len(inst.IpAddresses) == 0 {
+		return ""
+	}
+	return inst.IpAddresses[0].IpAddress
+}
+
+// operationsTable renders operations one per row.
+func operationsTable(ops []*sqladmin.Operation) output.TableFunc {
+	return func(wide bool) ([]string, [][]string) {
+		header := []string{"NAME", "TYPE", "STATUS", "INSTANCE"}
+		if wide {
+			header = append(header, "INSERT_TIME", "END_TIME", "ERRORS")
+		}
+		rows := make([][]string, 0, len(ops))
+		for _, op := range ops {
+			row := []string{op.Name, op.OperationType, op.Status, op.TargetId}
+			if wide {
+				row = append(row, op.InsertTime, op.EndTime, waiter.FormatErrors(op.Error))
+			}
+			rows = append(rows, row)
+		}
+		return header, rows
+	}
+}
+
+// formatID renders a numeric ID for a table cell, leaving zero blank.
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// validateOutputFlag rejects a bad --output value before a command changes
+// anything.
+func validateOutputFlag() error {
+	if _, err := output.Parse(viper.GetString("output")); err != nil {
+		return errkind.Validationf("invalid --output: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/spec"
+)
+
+// maxPatchAttempts bounds how often guardedPatch recomputes a patch after
+// another change to the instance got in first.
+const maxPatchAttempts = 3
+
+// patchBuilder computes the patch that takes an instance from current to
+// the requested state, with the changes it makes.
+type patchBuilder func(current *sqladmin.DatabaseInstance) (*sqladmin.DatabaseInstance, []spec.Change, error)
+
+// guardedPatch sends the patch build computes from current, carrying the
+// settingsVersion current was read at, so the API rejects it instead of
+// overwriting a change someone else made in between. When that happens,
+// what they changed, and who, is logged; if none of it touches the fields
+// the patch changes, the patch is recomputed from a fresh read and sent
+// again, otherwise guardedPatch fails with a Conflict error. The operation
+// is nil when there is nothing left to change.
+func guardedPatch(ctx context.Context, c client.Client, project, instance string, current *sqladmin.DatabaseInstance, build patchBuilder) (*sqladmin.Operation, []spec.Change, error) {
+	for attempt := 1; ; attempt++ {
+		patch, changes, err := build(current)
+		if err != nil || len(changes) == 0 {
+			return nil, changes, err
+		}
+		op, err := c.PatchInstance(ctx, project, instance, spec.Guard(patch, current))
+		if !isStale(err) {
+			return op, changes, err
+		}
+
+		fresh, getErr := c.GetInstance(ctx, project, instance)
+		if getErr != nil {
+			return nil, changes, fmt.Errorf("instance %s changed since it was read and could not be read again: %w", instance, getErr)
+		}
+		theirs := concurrentChanges(current, fresh)
+		reportConflict(ctx, c, project, instance, theirs)
+		if overlap := overlapping(changes, theirs); len(overlap) > 0 {
+			return nil, changes, errkind.New(errkind.Conflict, fmt.Errorf(
+				"instance %s was changed by someone else, including %s, which this change would overwrite; check its new state and run again",
+				instance, strings.Join(overlap, ", ")))
+		}
+		if attempt == maxPatchAttempts {
+			return nil, changes, errkind.New(errkind.Conflict, fmt.Errorf(
+				"instance %s kept changing, gave up after %d attempts: %w", instance, attempt, err))
+		}
+		log.Printf("The changes do not overlap; retrying on the fresh read of instance %s.\n", instance)
+		current = fresh
+	}
+}
+
+// isStale reports whether the API rejected a patch because its
+// settingsVersion is no longer the instance's.
+func isStale(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed
+}
+
+// concurrentChanges lists what changed between two reads of an instance,
+// leaving out the fields the server bumps on every change.
+func concurrentChanges(before, after *sqladmin.DatabaseInstance) []spec.Change {
+	var changes []spec.Change
+	for _, c := range spec.Diff(before, after) {
+		if c.Path != "etag" && c.Path != "settings.settingsVersion" {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// reportConflict logs the changes someone else made to an instance and, as
+// far as the operations list tells, who made them.
+func reportConflict(ctx context.Context, c client.Client, project, instance string, theirs []spec.Change) {
+	who := "someone else"
+	if ops, err := c.ListOperations(ctx, project, instance); err == nil {
+		var last *sqladmin.Operation
+		for _, op := range ops {
+			if last == nil || op.InsertTime > last.InsertTime {
+				last = op
+			}
+		}
+		if last != nil && last.User != "" {
+			who = fmt.Sprintf("%s (%s operation %s, started %s)", last.User, last.OperationType, last.Name, last.InsertTime)
+		}
+	}
+	if len(theirs) == 0 {
+		log.Warnf("Instance %s was modified by %s since it was read.\n", instance, who)
+		return
+	}
+	log.Warnf("Instance %s was modified by %s since it was read:\n", instance, who)
+	for _, ch := range theirs {
+		log.Warnf("  %s\n", ch)
+	}
+}
+
+// overlapping returns the paths of ours that theirs also changed, or that
+// contain or are contained in a path theirs changed.
+func overlapping(ours, theirs []spec.Change) []string {
+	var paths []string
+	for _, o := range ours {
+		for _, t := range theirs {
+			if o.Path == t.Path || strings.HasPrefix(o.Path, t.Path+".") || strings.HasPrefix(t.Path, o.Path+".") {
+				paths = append(paths, o.Path)
+				break
+			}
+		}
+	}
+	return paths
+}
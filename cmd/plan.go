@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/output"
+	"github.com/code4bread/sledge/spec"
+)
+
+var PlanCmd = &cobra.Command{
+	Use:   "plan (-f FILE... | --instance NAME [--dbVersion V] [--tier T] [--settingsFile F])",
+	Short: "Show the field-level changes apply or upgrade would make, without making them",
+	Long: `Plan compares each instance with its requested state and lists every field
+that would change, marking the changes that restart the instance or take it
+offline. The requested state comes from spec files (-f), as for apply, or
+from --dbVersion, --tier and --settingsFile, as for upgrade.
+
+Nothing is changed. Plan exits with code 10 (ChangesPending) when there are
+changes and 0 when the instances already match.`,
+	RunE: runPlan,
+}
+
+func init() {
+	PlanCmd.Flags().StringSliceP("filename", "f", nil, "Instance spec YAML file (repeatable)")
+	PlanCmd.Flags().String("project", "", "GCP Project ID, without -f")
+	PlanCmd.Flags().String("instance", "", "Name of the Cloud SQL instance, without -f")
+	PlanCmd.Flags().String("dbVersion", "", "Requested database version, without -f")
+	PlanCmd.Flags().String("tier", "", "Requested machine tier, without -f")
+	PlanCmd.Flags().String("settingsFile", "", "YAML file with requested instance settings, without -f")
+
+	bindFlag("plan.filename", PlanCmd.Flags().Lookup("filename"))
+	bindFlag("plan.project", PlanCmd.Flags().Lookup("project"))
+	bindFlag("plan.instance", PlanCmd.Flags().Lookup("instance"))
+	bindFlag("plan.dbVersion", PlanCmd.Flags().Lookup("dbVersion"))
+	bindFlag("plan.tier", PlanCmd.Flags().Lookup("tier"))
+	bindFlag("plan.settingsFile", PlanCmd.Flags().Lookup("settingsFile"))
+}
+
+func runPlan(cmd *cobra.Command, args []string) error {
+	specs, err := planSpecs()
+	if err != nil {
+		return err
+	}
+
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	var results planResults
+	for _, s := range specs {
+		r, err := planInstance(ctx, sqlClient, s)
+		if err != nil {
+			return err
+		}
+		results = append(results, r)
+	}
+	if err := printResult(results, results.table, output.Table); err != nil {
+		return err
+	}
+	if n := results.pending(); n > 0 {
+		return errkind.New(errkind.ChangesPending, fmt.Errorf("%d change(s) pending", n))
+	}
+	return nil
+}
+
+// planSpecs returns the requested state: the spec files, or a single spec
+// built from the flags. A spec built from flags leaves the region and
+// version empty so that planInstance keeps the instance's own.
+func planSpecs() ([]*spec.Instance, error) {
+	if files := listSetting("plan.filename", ","); len(files) > 0 {
+		if isSet("plan.instance") {
+			return nil, errkind.Validationf("use either -f or --instance, not both")
+		}
+		return loadSpecs(files)
+	}
+
+	cfg := config.LoadAppConfig()
+	s := &spec.Instance{
+		Name:            viper.GetString("plan.instance"),
+		Project:         stringSetting("plan.project", cfg.ProjectID),
+		DatabaseVersion: viper.GetString("plan.dbVersion"),
+	}
+	if s.Project == "" || s.Name == "" {
+		return nil, errkind.Validationf("spec files (-f), or project and instance, are required")
+	}
+	if path := viper.GetString("plan.settingsFile"); path != "" {
+		settings, err := spec.LoadSettings(path)
+		if err != nil {
+			return nil, errkind.Validationf("failed to load settings file: %v", err)
+		}
+		s.Settings = *settings
+	}
+	if isSet("plan.tier") {
+		s.Settings.Tier = viper.GetString("plan.tier")
+	}
+	s.Settings.Network.PrivateNetwork = spec.NetworkPath(s.Project, s.Settings.Network.PrivateNetwork)
+	return []*spec.Instance{s}, nil
+}
+
+// planResult is what applying one spec would do.
+type planResult struct {
+	Project  string        `json:"project"`
+	Instance string        `json:"instance"`
+	Action   string        `json:"action"`
+	Downtime bool          `json:"downtime"`
+	Changes  []spec.Change `json:"changes,omitempty"`
+}
+
+type planResults []planResult
+
+// pending counts the changes across all instances.
+func (rs planResults) pending() int {
+	n := 0
+	for _, r := range rs {
+		n += len(r.Changes)
+	}
+	return n
+}
+
+// table has a row per change, so the output can be attached to a change
+// ticket as is; an instance without changes gets a single row.
+func (rs planResults) table(wide bool) ([]string, [][]string) {
+	header := []string{"INSTANCE", "ACTION", "PATH", "OLD", "NEW", "DOWNTIME"}
+	if wide {
+		header = append(header, "PROJECT", "REASON")
+	}
+	var rows [][]string
+	for _, r := range rs {
+		changes := r.Changes
+		if len(changes) == 0 {
+			changes = []spec.Change{{}}
+		}
+		for _, c := range changes {
+			row := []string{r.Instance, r.Action, c.Path, "", "", strconv.FormatBool(c.Downtime)}
+			if c.Path != "" {
+				row[3], row[4] = spec.FormatValue(c.Old), spec.FormatValue(c.New)
+			}
+			if wide {
+				row = append(row, r.Project, c.Reason)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return header, rows
+}
+
+// planInstance diffs an instance against its spec without changing
+// anything. A missing instance is planned as a create listing every field
+// the spec sets.
+func planInstance(ctx context.Context, c client.Client, s *spec.Instance) (planResult, error) {
+	r := planResult{Project: s.Project, Instance: s.Name, Action: "none"}
+
+	current, err := c.GetInstance(ctx, s.Project, s.Name)
+	switch {
+	case errkind.Is(err, errkind.NotFound) && s.DatabaseVersion != "" && s.Region != "":
+		inst, err := s.NewInstance()
+		if err != nil {
+			return r, errkind.New(errkind.Validation, err)
+		}
+		r.Action = "create"
+		for _, ch := range spec.Diff(nil, inst) {
+			// Nothing is running yet, so nothing goes down.
+			ch.Downtime, ch.Reason = false, ""
+			r.Changes = append(r.Changes, ch)
+		}
+		r.Changes = append(r.Changes, missingDatabases(s, nil)...)
+		r.Changes = append(r.Changes, missingUsers(s, nil)...)
+		return r, nil
+	case err != nil:
+		return r, fmt.Errorf("failed to get instance %s: %w", s.Name, err)
+	}
+
+	if r.Changes, err = specChanges(ctx, c, s, current); err != nil {
+		return r, err
+	}
+	if len(r.Changes) > 0 {
+		r.Action = "update"
+	}
+	r.Downtime = spec.HasDowntime(r.Changes)
+	return r, nil
+}
+
+// specChanges lists what differs between an existing instance and its
+// spec: instance fields, then missing databases and users. A spec without
+// a region or version keeps the instance's own.
+func specChanges(ctx context.Context, c client.Client, s *spec.Instance, current *sqladmin.DatabaseInstance) ([]spec.Change, error) {
+	if s.Region == "" {
+		s.Region = current.Region
+	}
+	if s.DatabaseVersion == "" {
+		s.DatabaseVersion = current.DatabaseVersion
+	}
+	if err := s.Validate(); err != nil {
+		return nil, errkind.New(errkind.Validation, err)
+	}
+	desired, err := s.Desired(current)
+	if err != nil {
+		return nil, errkind.New(errkind.Validation, err)
+	}
+	changes := spec.Diff(current, desired)
+
+	if len(s.Databases) > 0 {
+		existing, err := c.ListDatabases(ctx, s.Project, s.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases of %s: %w", s.Name, err)
+		}
+		changes = append(changes, missingDatabases(s, existing)...)
+	}
+	if len(s.Users) > 0 {
+		existing, err := c.ListUsers(ctx, s.Project, s.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users of %s: %w", s.Name, err)
+		}
+		changes = append(changes, missingUsers(s, existing)...)
+	}
+	return changes, nil
+}
+
+// missingDatabases lists the spec's databases that do not exist as
+// changes to databases.<name>.
+func missingDatabases(s *spec.Instance, existing []*sqladmin.Database) []spec.Change {
+	have := map[string]bool{}
+	for _, db := range existing {
+		have[db.Name] = true
+	}
+	var changes []spec.Change
+	for _, db := range s.Databases {
+		if !have[db.Name] {
+			changes = append(changes, spec.Change{Path: "databases." + db.Name, New: db})
+		}
+	}
+	return changes
+}
+
+// missingUsers lists the spec's users that do not exist as changes to
+// users.<name>.
+func missingUsers(s *spec.Instance, existing []*sqladmin.User) []spec.Change {
+	var changes []spec.Change
+	for _, u := range s.Users {
+		if !hasUser(existing, u) {
+			changes = append(changes, spec.Change{Path: "users." + u.Name, New: u})
+		}
+	}
+	return changes
+}
+
+// logChanges logs changes about to be made, one per line under header, and
+// warns when any of them causes downtime.
+func logChanges(header string, changes []spec.Change) {
+	log.Printf("%s\n", header)
+	for _, c := range changes {
+		log.Printf("  %s\n", c)
+	}
+	if spec.HasDowntime(changes) {
+		log.Warnf("These changes restart the instance or take it offline.\n")
+	}
+}
@@ -1,14 +1,15 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
 	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
 )
 
 // RestoreCmd will restore a backup from an existing instance to a new or existing instance
@@ -28,27 +29,30 @@ func init() {
 	// you might add a --region for the new instance, but
 	// the Cloud SQL Admin API might not let you do direct cross-region restore.
 
-	viper.BindPFlag("restore.project", RestoreCmd.Flags().Lookup("project"))
-	viper.BindPFlag("restore.targetInstance", RestoreCmd.Flags().Lookup("targetInstance"))
-	viper.BindPFlag("restore.backupRunId", RestoreCmd.Flags().Lookup("backupRunId"))
-	viper.BindPFlag("restore.sourceInstance", RestoreCmd.Flags().Lookup("sourceInstance"))
+	bindFlag("restore.project", RestoreCmd.Flags().Lookup("project"))
+	bindFlag("restore.targetInstance", RestoreCmd.Flags().Lookup("targetInstance"))
+	bindFlag("restore.backupRunId", RestoreCmd.Flags().Lookup("backupRunId"))
+	bindFlag("restore.sourceInstance", RestoreCmd.Flags().Lookup("sourceInstance"))
+
+	addWaitFlags(RestoreCmd, "restore")
 }
 
 // runRestore calls Instances.RestoreBackup to restore from a specific backup run
 func runRestore(cmd *cobra.Command, args []string) error {
-	projectID := viper.GetString("restore.project")
+	cfg := config.LoadAppConfig()
+	projectID := stringSetting("restore.project", cfg.ProjectID)
 	targetInstance := viper.GetString("restore.targetInstance")
 	sourceInstance := viper.GetString("restore.sourceInstance")
 	backupRunID := viper.GetInt64("restore.backupRunId")
 
 	if projectID == "" || targetInstance == "" || backupRunID == 0 || sourceInstance == "" {
-		return fmt.Errorf("project, targetInstance, sourceInstance, and backupRunId are required")
+		return errkind.Validationf("project, targetInstance, sourceInstance, and backupRunId are required")
 	}
 
-	ctx := context.Background()
-	sqlService, err := sqladmin.NewService(ctx, option.WithScopes(sqladmin.CloudPlatformScope))
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create SQL Admin service: %v", err)
+		return err
 	}
 
 	// "Migrate" scenario:
@@ -64,15 +68,22 @@ func runRestore(cmd *cobra.Command, args []string) error {
 		},
 	}
 
-	op, err := sqlService.Instances.RestoreBackup(projectID, targetInstance, req).Context(ctx).Do()
+	op, err := sqlClient.RestoreBackup(ctx, projectID, targetInstance, req)
 	if err != nil {
 		if strings.Contains(err.Error(), "not supported for cross region") {
-			return fmt.Errorf("cross-region restore may not be supported for your DB version or region: %v", err)
+			return fmt.Errorf("cross-region restore may not be supported for your DB version or region: %w", err)
 		}
-		return fmt.Errorf("error restoring backup to instance %s: %v", targetInstance, err)
+		return fmt.Errorf("error restoring backup to instance %s: %w", targetInstance, err)
 	}
 
 	log.Printf("Restore initiated for target instance %s from backup ID %d. Operation: %s\n",
 		targetInstance, backupRunID, op.Name)
-	return nil
+	op, err = waitIfRequested(ctx, sqlClient, "restore", projectID, op)
+	if err != nil {
+		return err
+	}
+	result := newOperationResult(projectID, targetInstance, op)
+	result.BackupRunID = backupRunID
+	result.SourceInstance = sourceInstance
+	return printResult(result, result.table, "")
 }
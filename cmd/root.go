@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/errkind"
 	"github.com/code4bread/sledge/logger"
 )
 
@@ -15,23 +22,163 @@ var log = logger.Logger
 var (
 	cfgFile string
 
+	// profileErr records a failure to apply the selected profile in
+	// initConfig, which cannot return errors itself.
+	profileErr error
+
+	// apiClient is shared by every subcommand. It is built lazily by
+	// getClient unless one was injected with SetClient.
+	apiClient client.Client
+
 	rootCmd = &cobra.Command{
 		Use:   "sledge",
 		Short: "CLI to manage GCP Cloud SQL operations",
 		Long:  `A demonstration CLI built with Cobra, Viper, and GCP's Cloud SQL Admin API.`,
+		// Errors are logged by main; usage is only printed for bad flags.
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			// The config subcommands must keep working so a broken
+			// current_profile can be fixed with them.
+			if profileErr != nil && cmd.Parent() != ConfigCmd {
+				return profileErr
+			}
+			if err := logger.Validate(viper.GetString("log.format"), viper.GetString("log.level")); err != nil {
+				return errkind.New(errkind.Validation, err)
+			}
+			return validateOutputFlag()
+		},
 	}
 )
 
-// Execute runs the root command
+// Execute runs the root command. SIGINT and SIGTERM cancel the command's
+// context; the returned error then wraps ErrInterrupted.
 func Execute() error {
-	return rootCmd.Execute()
+	return executeWithSignals()
+}
+
+// SetClient injects the Cloud SQL client used by all subcommands, e.g. a
+// fake in tests or a client configured by a program embedding sledge.
+func SetClient(c client.Client) {
+	apiClient = c
+}
+
+// getClient returns the injected client or builds one from the global flags.
+func getClient(ctx context.Context) (client.Client, error) {
+	if apiClient != nil {
+		return apiClient, nil
+	}
+
+	var opts []client.Option
+	if endpoint := viper.GetString("endpoint"); endpoint != "" {
+		opts = append(opts, client.WithEndpoint(endpoint))
+	}
+	if credentials := config.LoadAppConfig().Credentials; credentials != "" {
+		opts = append(opts, client.WithCredentialsFile(credentials))
+	}
+	if log.IsLevelEnabled(logrus.DebugLevel) {
+		opts = append(opts, client.WithRequestLogging(logRequest))
+	}
+
+	c, err := client.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := retryPolicy()
+	if err != nil {
+		return nil, err
+	}
+	apiClient = client.NewRetrying(c, policy)
+	return apiClient, nil
+}
+
+// retryPolicy builds the retry policy from the retry.* config keys.
+func retryPolicy() (client.RetryPolicy, error) {
+	policy := client.RetryPolicy{
+		MaxAttempts:    viper.GetInt("retry.maxAttempts"),
+		InitialBackoff: viper.GetDuration("retry.initialBackoff"),
+		MaxBackoff:     viper.GetDuration("retry.maxBackoff"),
+		RetryConflicts: viper.GetBool("retry.onConflict"),
+		OnRetry: func(r client.Retry) {
+			log.Warnf("%s failed (attempt %d of %d): %v; retrying in %s",
+				r.Method, r.Attempt, r.MaxAttempts, r.Err, r.Wait.Round(time.Millisecond))
+		},
+	}
+	for _, code := range listSetting("retry.codes", ",") {
+		n, err := strconv.Atoi(code)
+		if err != nil {
+			return policy, errkind.Validationf("invalid HTTP status code %q in retry.codes", code)
+		}
+		policy.RetryableCodes = append(policy.RetryableCodes, n)
+	}
+	return policy, nil
 }
 
+// logRequest debug-logs one Cloud SQL Admin API call.
+func logRequest(r client.Request) {
+	entry := log.WithFields(logrus.Fields{
+		"method":  r.Method,
+		"url":     r.URL,
+		"status":  r.Status,
+		"latency": r.Latency.Round(time.Millisecond).String(),
+	})
+	if r.Err != nil {
+		entry.WithError(r.Err).Debug("Cloud SQL API request failed")
+		return
+	}
+	entry.Debug("Cloud SQL API request")
+}
+
+// stringSetting returns the value of a per-command key when it was set
+// explicitly (flag, environment or config file). Otherwise it falls back to
+// the global value from AppConfig, and finally to the flag's own default.
+func stringSetting(key, global string) string {
+	if viper.IsSet(key) || global == "" {
+		return viper.GetString(key)
+	}
+	return global
+}
 
 func init() {
 	// Global --config flag
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Config file (default is $HOME/.sledge.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Config file (default is $HOME/.sledge.yaml, env: "+config.ConfigEnv+")")
+	rootCmd.PersistentFlags().String("endpoint", "", "Override the Cloud SQL Admin API endpoint (e.g. a local emulator)")
+	bindFlag("endpoint", rootCmd.PersistentFlags().Lookup("endpoint"))
+	rootCmd.PersistentFlags().Bool("cleanupOnInterrupt", false, "After Ctrl-C, delete partially created resources if Ctrl-C is pressed a second time")
+	bindFlag("cleanupOnInterrupt", rootCmd.PersistentFlags().Lookup("cleanupOnInterrupt"))
+
+	// Global settings, used by every subcommand that has no value of its own.
+	// Subcommands with a local --project or --region flag shadow these, with
+	// the same meaning.
+	rootCmd.PersistentFlags().String("project", "", "Default GCP Project ID for all commands (config: project_id)")
+	rootCmd.PersistentFlags().String("credentials", "", "Service account or refresh token JSON file (config: credentials)")
+	rootCmd.PersistentFlags().String("region", "", "Default region for new instances (config: default_region)")
+	bindFlag(config.KeyProjectID, rootCmd.PersistentFlags().Lookup("project"))
+	bindFlag(config.KeyCredentials, rootCmd.PersistentFlags().Lookup("credentials"))
+	bindFlag(config.KeyDefaultRegion, rootCmd.PersistentFlags().Lookup("region"))
+	rootCmd.PersistentFlags().StringP("output", "o", "", "Print the result as json, yaml, table, wide, csv or template=GO_TEMPLATE")
+	bindFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+	rootCmd.PersistentFlags().String("log-format", "text", "Log format: text or json (logs go to stderr)")
+	rootCmd.PersistentFlags().String("log-level", "info", "Log level: debug, info, warn or error; debug also logs every API request")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only log errors")
+	bindFlag("log.format", rootCmd.PersistentFlags().Lookup("log-format"))
+	bindFlag("log.level", rootCmd.PersistentFlags().Lookup("log-level"))
+	bindFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
+	rootCmd.PersistentFlags().String("profile", "", "Named profile from the config file to use (env: "+config.ProfileEnv+")")
+	bindFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+	viper.BindEnv("profile", config.ProfileEnv)
+	// Retries of transient API errors are configured in the file or the
+	// environment only; see client.RetryPolicy for the meaning.
+	viper.SetDefault("retry.maxAttempts", 4)
+	viper.SetDefault("retry.initialBackoff", "1s")
+	viper.SetDefault("retry.maxBackoff", "30s")
+	viper.SetDefault("retry.codes", client.DefaultRetryableCodes)
+	viper.SetDefault("retry.onConflict", true)
 	cobra.OnInitialize(initConfig)
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return errkind.New(errkind.Validation, err)
+	})
 
 	// Add subcommands
 	rootCmd.AddCommand(CreateCmd)
@@ -39,11 +186,32 @@ func init() {
 	rootCmd.AddCommand(MigrateCmd)
 	rootCmd.AddCommand(DeleteCmd)
 	rootCmd.AddCommand(BackupCmd)
-    rootCmd.AddCommand(RestoreCmd)
+	rootCmd.AddCommand(RestoreCmd)
 	rootCmd.AddCommand(describeCmd)
+	rootCmd.AddCommand(ListCmd)
+	rootCmd.AddCommand(ApplyCmd)
+	rootCmd.AddCommand(PlanCmd)
+	rootCmd.AddCommand(DriftCmd)
+	rootCmd.AddCommand(ExportSpecCmd)
+	rootCmd.AddCommand(OperationsCmd)
+	rootCmd.AddCommand(EmulatorCmd)
+	rootCmd.AddCommand(ConfigCmd)
+}
+
+// applyLogSettings configures the logger from log.format, log.level and
+// quiet. Invalid values are reported by PersistentPreRunE.
+func applyLogSettings() {
+	logger.SetFormatter(viper.GetString("log.format"))
+	logger.SetLevel(viper.GetString("log.level"))
+	if viper.GetBool("quiet") {
+		logger.SetLevel("error")
+	}
 }
 
 func initConfig() {
+	if cfgFile == "" {
+		cfgFile = os.Getenv(config.ConfigEnv)
+	}
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
 	} else {
@@ -52,8 +220,26 @@ func initConfig() {
 		viper.AddConfigPath(home)
 		viper.SetConfigName(".sledge")
 	}
-	viper.AutomaticEnv()
-	if err := viper.ReadInConfig(); err == nil {
+	config.SetupEnv()
+	readErr := viper.ReadInConfig()
+
+	// --profile and SLEDGE_PROFILE win over the file's current_profile.
+	profile := viper.GetString("profile")
+	if profile == "" {
+		profile = viper.GetString(config.KeyCurrentProfile)
+	}
+	profileErr = nil
+	if err := config.ApplyProfile(profile); err != nil {
+		profileErr = errkind.New(errkind.Validation, err)
+	}
+
+	// Logging settings may come from the file or the profile, so they are
+	// applied before anything is logged.
+	applyLogSettings()
+	if readErr == nil {
 		log.Info("Using config file:", viper.ConfigFileUsed())
 	}
+	if profileErr == nil && profile != "" {
+		log.Infof("Using profile: %s (project %s)", profile, config.LoadAppConfig().ProjectID)
+	}
 }
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/code4bread/sledge/config"
+)
+
+// boundFlags maps every config key bound with bindFlag to its flag, so the
+// config subcommands know the keys, types and defaults sledge understands.
+var boundFlags = map[string]*pflag.Flag{}
+
+// configOnlySettings are keys read from the config file that have no flag.
+var configOnlySettings = []config.Setting{
+	{Key: "operations.project", Type: "string"},
+	{Key: "create.rootPassword", Type: "string"},
+	{Key: config.KeyProjects, Type: "stringSlice"},
+	{Key: "retry.maxAttempts", Type: "int"},
+	{Key: "retry.initialBackoff", Type: "duration"},
+	{Key: "retry.maxBackoff", Type: "duration"},
+	{Key: "retry.codes", Type: "intSlice"},
+	{Key: "retry.onConflict", Type: "bool"},
+}
+
+// settingFallbacks maps per-command keys to the global key stringSetting
+// falls back to when they are not set.
+var settingFallbacks = map[string]string{
+	"create.project":        config.KeyProjectID,
+	"create.region":         config.KeyDefaultRegion,
+	"delete.project":        config.KeyProjectID,
+	"describe.project":      config.KeyProjectID,
+	"upgrade.project":       config.KeyProjectID,
+	"backup.project":        config.KeyProjectID,
+	"restore.project":       config.KeyProjectID,
+	"migrate.sourceProject": config.KeyProjectID,
+	"migrate.targetRegion":  config.KeyDefaultRegion,
+	"operations.project":    config.KeyProjectID,
+}
+
+// requiredSettings lists, per command section of the config file, the keys
+// the command cannot run without. `sledge config validate` reports them when
+// a section exists but neither it nor a fallback provides a value.
+var requiredSettings = map[string][]string{
+	"create":   {"create.project", "create.instance"},
+	"delete":   {"delete.project", "delete.instance"},
+	"describe": {"describe.project", "describe.instance"},
+	"upgrade":  {"upgrade.project", "upgrade.instance"},
+	"backup":   {"backup.project", "backup.instance"},
+	"restore":  {"restore.project", "restore.targetInstance", "restore.sourceInstance"},
+	"migrate":  {"migrate.sourceProject", "migrate.sourceInstance", "migrate.targetInstance", "migrate.targetRegion"},
+}
+
+// bindFlag binds a config key to a flag, like viper.BindPFlag, and records
+// it for the config subcommands.
+func bindFlag(key string, flag *pflag.Flag) {
+	viper.BindPFlag(key, flag)
+	boundFlags[key] = flag
+}
+
+// knownSettings returns every config key sledge understands, sorted.
+func knownSettings() []config.Setting {
+	settings := append([]config.Setting{}, configOnlySettings...)
+	for key, flag := range boundFlags {
+		settings = append(settings, config.Setting{Key: key, Type: flag.Value.Type()})
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+// listSetting returns a list-valued key. Lists from the environment or a
+// scalar in the config file arrive as one string and are split on sep.
+func listSetting(key, sep string) []string {
+	s, ok := viper.Get(key).(string)
+	if !ok {
+		return viper.GetStringSlice(key)
+	}
+	var values []string
+	for _, v := range strings.Split(s, sep) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// effectiveValue returns the value a command would use for key, applying
+// the same global fallback as stringSetting.
+func effectiveValue(key string) string {
+	if global, ok := settingFallbacks[key]; ok {
+		return stringSetting(key, viper.GetString(global))
+	}
+	return viper.GetString(key)
+}
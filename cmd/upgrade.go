@@ -2,18 +2,47 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"google.golang.org/api/option"
 	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/config"
+	"github.com/code4bread/sledge/engine"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/spec"
+	"github.com/code4bread/sledge/waiter"
 )
 
 var UpgradeCmd = &cobra.Command{
 	Use:   "upgrade",
 	Short: "Upgrade a Cloud SQL instance version or tier",
-	RunE:  runUpgrade,
+	Long: `Upgrade changes the database version and/or machine tier of an instance.
+
+The version must be an in-place upgrade Cloud SQL supports: MySQL one major
+version at a time (5.6 -> 5.7 -> 8.0 -> 8.4) or to a later 8.0 minor version,
+PostgreSQL to any later version, SQL Server to a later year of the same
+edition. Downgrades and engine changes are rejected. Database flags the new
+version no longer accepts are warned about.
+
+A major version upgrade is sent on its own; with --tier, the tier change
+follows once the upgrade is done.
+
+Only the changed fields are sent, with the settingsVersion they were read
+at. If someone else changes the instance in between, their changes are
+reported; when they touch other fields, the upgrade is retried on a fresh
+read, otherwise it stops with a Conflict error (exit code 7).
+
+With --backup, an on-demand backup is taken first, the upgrade is waited
+for, and the backup run ID is part of the output, also when the upgrade
+fails. If the upgrade then fails, the sledge restore command that rolls the
+instance back is printed; with --rollback, the backup is restored instead.`,
+	RunE: runUpgrade,
 }
 
 func init() {
@@ -21,53 +50,283 @@ func init() {
 	UpgradeCmd.Flags().String("instance", "", "Name of the existing Cloud SQL instance (required)")
 	UpgradeCmd.Flags().String("dbVersion", "", "New Database version, e.g. MYSQL_8_0")
 	UpgradeCmd.Flags().String("tier", "", "New Machine type tier (optional)")
+	UpgradeCmd.Flags().Bool("backup", false, "Take an on-demand backup before upgrading (implies --wait)")
+	UpgradeCmd.Flags().Bool("rollback", false, "Restore the pre-upgrade backup if the upgrade fails (implies --backup)")
+
+	bindFlag("upgrade.project", UpgradeCmd.Flags().Lookup("project"))
+	bindFlag("upgrade.instance", UpgradeCmd.Flags().Lookup("instance"))
+	bindFlag("upgrade.dbVersion", UpgradeCmd.Flags().Lookup("dbVersion"))
+	bindFlag("upgrade.tier", UpgradeCmd.Flags().Lookup("tier"))
+	bindFlag("upgrade.backup", UpgradeCmd.Flags().Lookup("backup"))
+	bindFlag("upgrade.rollback", UpgradeCmd.Flags().Lookup("rollback"))
 
-	viper.BindPFlag("upgrade.project", UpgradeCmd.Flags().Lookup("project"))
-	viper.BindPFlag("upgrade.instance", UpgradeCmd.Flags().Lookup("instance"))
-	viper.BindPFlag("upgrade.dbVersion", UpgradeCmd.Flags().Lookup("dbVersion"))
-	viper.BindPFlag("upgrade.tier", UpgradeCmd.Flags().Lookup("tier"))
+	addWaitFlags(UpgradeCmd, "upgrade")
 }
 
 func runUpgrade(cmd *cobra.Command, args []string) error {
-	projectID := viper.GetString("upgrade.project")
+	cfg := config.LoadAppConfig()
+	projectID := stringSetting("upgrade.project", cfg.ProjectID)
 	instanceName := viper.GetString("upgrade.instance")
 	newVersion := viper.GetString("upgrade.dbVersion")
 	newTier := viper.GetString("upgrade.tier")
 
 	if projectID == "" || instanceName == "" {
-		return fmt.Errorf("project and instance are required")
+		return errkind.Validationf("project and instance are required")
 	}
 
-	ctx := context.Background()
-	sqlService, err := sqladmin.NewService(ctx, option.WithScopes(sqladmin.CloudPlatformScope))
+	ctx := commandContext(cmd)
+	sqlClient, err := getClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create sql admin service: %v", err)
+		return err
 	}
 
 	// Retrieve current instance
-	currentInst, err := sqlService.Instances.Get(projectID, instanceName).Context(ctx).Do()
+	currentInst, err := sqlClient.GetInstance(ctx, projectID, instanceName)
 	if err != nil {
-		return fmt.Errorf("could not find instance %s: %v", instanceName, err)
+		return fmt.Errorf("could not find instance %s: %w", instanceName, err)
 	}
 
-	// Update the version if provided
 	if newVersion != "" {
-		currentInst.DatabaseVersion = newVersion
+		var flags []*sqladmin.DatabaseFlags
+		if currentInst.Settings != nil {
+			flags = currentInst.Settings.DatabaseFlags
+		}
+		if err := checkUpgrade(currentInst, newVersion, flags); err != nil {
+			return err
+		}
+	}
+
+	_, changes, _ := upgradePatch(newVersion, newTier)(currentInst)
+	if len(changes) == 0 {
+		log.Printf("Instance %s already has the requested version and tier.\n", instanceName)
+		return nil
+	}
+	logChanges(fmt.Sprintf("Upgrading instance %s:", instanceName), changes)
+
+	rollback := viper.GetBool("upgrade.rollback")
+	var backupID int64
+	if viper.GetBool("upgrade.backup") || rollback {
+		if backupID, err = preUpgradeBackup(ctx, sqlClient, projectID, currentInst); err != nil {
+			return err
+		}
+	}
+
+	// With a backup, only waiting tells whether the way back is needed.
+	u := &upgrader{client: sqlClient, project: projectID, wait: viper.GetBool("upgrade.wait") || backupID != 0}
+	op, err := u.run(ctx, currentInst, newVersion, newTier)
+	if err != nil {
+		if backupID == 0 {
+			return err
+		}
+		if u.last != nil {
+			err = u.rollBack(ctx, instanceName, backupID, rollback, err)
+		}
+		// Print the backup run ID for scripts, which do not parse errors.
+		result := operationResult{Project: projectID, Instance: instanceName}
+		if u.last != nil {
+			result = newOperationResult(projectID, instanceName, u.last)
+		}
+		result.BackupRunID = backupID
+		if perr := printResult(result, result.table, ""); perr != nil {
+			log.Errorf("Failed to print the result: %v\n", perr)
+		}
+		return err
+	}
+	if op == nil {
+		log.Printf("Instance %s already has the requested version and tier.\n", instanceName)
+		return nil
+	}
+	result := newOperationResult(projectID, instanceName, op)
+	result.BackupRunID = backupID
+	return printResult(result, result.table, "")
+}
+
+// upgrader sends the patches of one upgrade and records the last operation
+// they started, if any, i.e. whether the instance may have changed.
+type upgrader struct {
+	client  client.Client
+	project string
+	// wait is whether to wait for the last operation; earlier ones are
+	// always waited for.
+	wait bool
+	last *sqladmin.Operation
+}
+
+// run moves inst to version and tier. A major version upgrade is sent on
+// its own, since the API rejects it combined with other changes, so a new
+// tier follows once it is done. The operation is nil when there was
+// nothing left to change.
+func (u *upgrader) run(ctx context.Context, inst *sqladmin.DatabaseInstance, version, tier string) (*sqladmin.Operation, error) {
+	if version != "" && tier != "" && engine.IsMajorUpgrade(inst.DatabaseVersion, version) {
+		log.Printf("Upgrading instance %s to %s before the other changes...\n", inst.Name, version)
+		if _, err := u.patch(ctx, inst, version, "", true); err != nil {
+			return nil, err
+		}
+		upgraded, err := u.client.GetInstance(ctx, u.project, inst.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get instance %s: %w", inst.Name, err)
+		}
+		inst, version = upgraded, ""
+	}
+	return u.patch(ctx, inst, version, tier, u.wait)
+}
+
+func (u *upgrader) patch(ctx context.Context, inst *sqladmin.DatabaseInstance, version, tier string, wait bool) (*sqladmin.Operation, error) {
+	op, _, err := guardedPatch(ctx, u.client, u.project, inst.Name, inst, upgradePatch(version, tier))
+	if err != nil {
+		return nil, fmt.Errorf("error updating instance %s: %w", inst.Name, err)
 	}
+	if op == nil {
+		return nil, nil
+	}
+	u.last = op
+	log.Printf("Upgrade initiated for instance %s. Operation: %s\n", inst.Name, op.Name)
+	if !wait {
+		return op, nil
+	}
+	log.Printf("Waiting for operation %s to complete...\n", op.Name)
+	done, err := waitForOperation(ctx, u.client, u.project, op,
+		viper.GetDuration("upgrade.pollInterval"), viper.GetDuration("upgrade.timeout"))
+	if err != nil {
+		var failed *waiter.OperationError
+		if errors.As(err, &failed) {
+			u.last = failed.Operation
+		}
+		return nil, err
+	}
+	log.Printf("Operation %s completed successfully.\n", op.Name)
+	return done, nil
+}
 
-	// Update the tier if provided
-	if newTier != "" {
-		if currentInst.Settings == nil {
-			currentInst.Settings = &sqladmin.Settings{}
+// rollBack handles an upgrade that failed after changing, or starting to
+// change, the instance. With restore set and the upgrade operation failed,
+// the pre-upgrade backup is restored into the instance; otherwise, or if
+// the restore fails too, the restore command to run is logged. The error
+// returned always wraps cause.
+func (u *upgrader) rollBack(ctx context.Context, instance string, backupID int64, restore bool, cause error) error {
+	if restore && errkind.Is(cause, errkind.OperationFailed) {
+		log.Warnf("Upgrade of instance %s failed; restoring pre-upgrade backup run %d...\n", instance, backupID)
+		err := u.restore(ctx, instance, backupID)
+		if err == nil {
+			return fmt.Errorf("upgrade failed, instance %s was restored from pre-upgrade backup run %d: %w",
+				instance, backupID, cause)
 		}
-		currentInst.Settings.Tier = newTier
+		log.Errorf("Failed to restore backup run %d into instance %s: %v\n", backupID, instance, err)
+	}
+	log.Warnf("To roll instance %s back to its pre-upgrade backup, run:\n  sledge restore --project %s --targetInstance %s --sourceInstance %s --backupRunId %d\n",
+		instance, u.project, instance, instance, backupID)
+	return fmt.Errorf("upgrade failed, pre-upgrade backup run %d of instance %s is kept: %w", backupID, instance, cause)
+}
+
+func (u *upgrader) restore(ctx context.Context, instance string, backupID int64) error {
+	op, err := u.client.RestoreBackup(ctx, u.project, instance, &sqladmin.InstancesRestoreBackupRequest{
+		RestoreBackupContext: &sqladmin.RestoreBackupContext{
+			BackupRunId: backupID,
+			InstanceId:  instance,
+			Project:     u.project,
+		},
+	})
+	if err != nil {
+		return err
 	}
+	_, err = waitForOperation(ctx, u.client, u.project, op,
+		viper.GetDuration("upgrade.pollInterval"), viper.GetDuration("upgrade.timeout"))
+	return err
+}
 
-	op, err := sqlService.Instances.Patch(projectID, instanceName, currentInst).Context(ctx).Do()
+// preUpgradeBackup takes an on-demand backup of inst, waits for it and
+// returns its backup run ID. A failed backup stops the upgrade before
+// anything changed.
+func preUpgradeBackup(ctx context.Context, c client.Client, project string, inst *sqladmin.DatabaseInstance) (int64, error) {
+	description := fmt.Sprintf("sledge pre-upgrade backup of %s at %s", inst.Name, time.Now().UTC().Format(time.RFC3339))
+	log.Printf("Backing up instance %s before upgrading...\n", inst.Name)
+	op, err := c.InsertBackupRun(ctx, project, inst.Name, &sqladmin.BackupRun{Description: description})
+	if err != nil {
+		return 0, fmt.Errorf("error creating pre-upgrade backup of instance %s: %w", inst.Name, err)
+	}
+	done, err := waitForOperation(ctx, c, project, op,
+		viper.GetDuration("upgrade.pollInterval"), viper.GetDuration("upgrade.timeout"))
 	if err != nil {
-		return fmt.Errorf("error updating instance: %v", err)
+		return 0, fmt.Errorf("pre-upgrade backup of instance %s failed, nothing was upgraded: %w", inst.Name, err)
+	}
+
+	var id int64
+	if done.BackupContext != nil {
+		id = done.BackupContext.BackupId
+	} else if op.BackupContext != nil {
+		id = op.BackupContext.BackupId
+	}
+	if id == 0 {
+		// Not every operation carries its backup context; find the run by
+		// its description, as migrate does.
+		runs, err := c.ListBackupRuns(ctx, project, inst.Name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list backup runs of instance %s: %w", inst.Name, err)
+		}
+		for _, br := range runs {
+			if br.Description == description {
+				id = br.Id
+			}
+		}
+		if id == 0 {
+			return 0, fmt.Errorf("could not find the pre-upgrade backup run of instance %s", inst.Name)
+		}
 	}
+	log.Printf("Pre-upgrade backup run %d of instance %s is done.\n", id, inst.Name)
+	return id, nil
+}
 
-	log.Printf("Upgrade initiated for instance %s. Operation: %s\n", instanceName, op.Name)
+// checkUpgrade validates moving inst to version: the path must be one Cloud
+// SQL supports in place and, for a major upgrade the API lists targets for,
+// one of the instance's upgradableDatabaseVersions. MySQL 8.0 minor versions
+// are not always listed there, so listing MYSQL_8_0 offers them all.
+// Database flags the version no longer accepts
+// are warned about, not rejected, since the upgrade may be what prompts
+// removing them.
+func checkUpgrade(inst *sqladmin.DatabaseInstance, version string, flags []*sqladmin.DatabaseFlags) error {
+	if version == inst.DatabaseVersion {
+		return nil
+	}
+	if err := engine.ValidateUpgrade(inst.DatabaseVersion, version); err != nil {
+		return errkind.Validationf("%s: %v", inst.Name, err)
+	}
+	if offered := inst.UpgradableDatabaseVersions; len(offered) > 0 && engine.IsMajorUpgrade(inst.DatabaseVersion, version) {
+		var names []string
+		found := false
+		for _, v := range offered {
+			names = append(names, v.Name)
+			found = found || !engine.IsMajorUpgrade(v.Name, version)
+		}
+		if !found {
+			return errkind.Validationf("%s: Cloud SQL does not offer an upgrade from %s to %s (offered: %s)",
+				inst.Name, inst.DatabaseVersion, version, strings.Join(names, ", "))
+		}
+	}
+	var names []string
+	for _, f := range flags {
+		names = append(names, f.Name)
+	}
+	for _, problem := range engine.IncompatibleFlags(inst.DatabaseVersion, version, names) {
+		log.Warnf("%s: %s; remove or replace it before upgrading.\n", inst.Name, problem)
+	}
 	return nil
 }
+
+// upgradePatch builds the minimal patch moving an instance to version
+// and tier; empty values are left as they are.
+func upgradePatch(version, tier string) patchBuilder {
+	return func(current *sqladmin.DatabaseInstance) (*sqladmin.DatabaseInstance, []spec.Change, error) {
+		upgraded := spec.CloneInstance(current)
+		if version != "" {
+			upgraded.DatabaseVersion = version
+		}
+		if tier != "" {
+			if upgraded.Settings == nil {
+				upgraded.Settings = &sqladmin.Settings{}
+			}
+			upgraded.Settings.Tier = tier
+		}
+		changes := spec.Diff(current, upgraded)
+		return spec.Patch(upgraded, changes), changes, nil
+	}
+}
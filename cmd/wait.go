@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/waiter"
+)
+
+// addWaitFlags registers --wait, --timeout and --pollInterval on a mutating
+// command and binds them under the command's viper prefix.
+func addWaitFlags(cmd *cobra.Command, prefix string) {
+	cmd.Flags().Bool("wait", false, "Block until the operation is DONE and fail if it reports errors")
+	cmd.Flags().Duration("timeout", 10*time.Minute, "How long --wait blocks before giving up")
+	cmd.Flags().Duration("pollInterval", 5*time.Second, "Initial interval for polling operation status with --wait (backs off up to 30s)")
+
+	bindFlag(prefix+".wait", cmd.Flags().Lookup("wait"))
+	bindFlag(prefix+".timeout", cmd.Flags().Lookup("timeout"))
+	bindFlag(prefix+".pollInterval", cmd.Flags().Lookup("pollInterval"))
+}
+
+// waitIfRequested polls op until completion when <prefix>.wait is set. It
+// returns the latest known state of the operation.
+func waitIfRequested(ctx context.Context, sqlClient client.Client, prefix, projectID string, op *sqladmin.Operation) (*sqladmin.Operation, error) {
+	if !viper.GetBool(prefix + ".wait") {
+		return op, nil
+	}
+	log.Printf("Waiting for operation %s to complete...\n", op.Name)
+	done, err := waitForOperation(ctx, sqlClient, projectID, op,
+		viper.GetDuration(prefix+".pollInterval"), viper.GetDuration(prefix+".timeout"))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Operation %s completed successfully.\n", op.Name)
+	return done, nil
+}
+
+// waitForOperation blocks until the operation is DONE, backing off from
+// interval between polls and logging each status change, and returns the
+// finished operation. The operation is reported as in flight if sledge is
+// interrupted meanwhile.
+func waitForOperation(ctx context.Context, sqlClient client.Client, projectID string, op *sqladmin.Operation,
+	interval, timeout time.Duration) (*sqladmin.Operation, error) {
+
+	done := trackOperation(projectID, op)
+	lastStatus := ""
+	w := waiter.New(sqlClient, waiter.Options{
+		InitialInterval: interval,
+		Timeout:         timeout,
+		OnProgress: func(p waiter.Progress) {
+			if p.Status() != lastStatus {
+				log.Printf("Operation %s (%s) is %s after %s\n",
+					p.Operation.Name, p.Type(), p.Status(), p.Elapsed.Round(time.Second))
+				lastStatus = p.Status()
+			} else {
+				log.Debugf("Operation %s (%s) still %s after %s",
+					p.Operation.Name, p.Type(), p.Status(), p.Elapsed.Round(time.Second))
+			}
+		},
+	})
+	finished, err := w.Wait(ctx, projectID, op.Name)
+	if ctx.Err() == nil {
+		// Only an interrupt leaves the operation in flight.
+		done()
+	}
+	return finished, err
+}
+
+// deleteInstanceCleanup returns a cleanup that waits for the operation
+// creating an instance to settle and then deletes the instance.
+func deleteInstanceCleanup(sqlClient client.Client, projectID, instanceName string, createOp *sqladmin.Operation) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		// The instance cannot be deleted while it is still being created;
+		// a failed creation is fine, the delete below then reports not found.
+		waiter.New(sqlClient, waiter.Options{}).Wait(ctx, projectID, createOp.Name)
+		op, err := sqlClient.DeleteInstance(ctx, projectID, instanceName)
+		if err != nil {
+			return fmt.Errorf("error deleting instance %s: %w", instanceName, err)
+		}
+		_, err = waiter.New(sqlClient, waiter.Options{}).Wait(ctx, projectID, op.Name)
+		return err
+	}
+}
+
+// deleteBackupRunCleanup returns a cleanup that deletes a backup run.
+func deleteBackupRunCleanup(sqlClient client.Client, projectID, instanceName string, id int64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		op, err := sqlClient.DeleteBackupRun(ctx, projectID, instanceName, id)
+		if err != nil {
+			return fmt.Errorf("error deleting backup run %d: %w", id, err)
+		}
+		_, err = waiter.New(sqlClient, waiter.Options{}).Wait(ctx, projectID, op.Name)
+		return err
+	}
+}
@@ -2,16 +2,29 @@ package config
 
 import "github.com/spf13/viper"
 
+// Keys of the global settings shared by every command. They can be set in
+// the config file or with the --project, --credentials and --region flags.
+const (
+	KeyProjectID     = "project_id"
+	KeyCredentials   = "credentials"
+	KeyDefaultRegion = "default_region"
+	// KeyProjects lists the projects commands that span several projects,
+	// such as list, operate on when no project is given.
+	KeyProjects = "projects"
+)
+
+// AppConfig holds the global settings commands fall back to when their own
+// per-command keys are not set.
 type AppConfig struct {
-	ProjectID      string
-	Credentials    string
-	DefaultRegion  string
+	ProjectID     string
+	Credentials   string
+	DefaultRegion string
 }
 
 func LoadAppConfig() AppConfig {
 	return AppConfig{
-		ProjectID:     viper.GetString("project_id"),
-		Credentials:   viper.GetString("credentials"),
-		DefaultRegion: viper.GetString("default_region"),
+		ProjectID:     viper.GetString(KeyProjectID),
+		Credentials:   viper.GetString(KeyCredentials),
+		DefaultRegion: viper.GetString(KeyDefaultRegion),
 	}
 }
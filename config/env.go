@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Every config key can be set from the environment as SLEDGE_ followed by
+// the key in upper case with dots replaced by underscores, e.g.
+// migrate.targetRegion is read from SLEDGE_MIGRATE_TARGETREGION.
+const (
+	EnvPrefix = "SLEDGE"
+	// ConfigEnv names the config file when --config is not given.
+	ConfigEnv = "SLEDGE_CONFIG"
+)
+
+var envKeyReplacer = strings.NewReplacer(".", "_")
+
+// SetupEnv makes viper read every key from its SLEDGE_ environment variable.
+func SetupEnv() {
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(envKeyReplacer)
+	viper.AutomaticEnv()
+}
+
+// EnvVar returns the environment variable key is read from.
+func EnvVar(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// Keys and environment variable used for named profiles. A profile is a
+// mapping under "profiles" holding any global or per-command settings; the
+// selected profile overrides the top-level values of the config file.
+const (
+	KeyProfiles       = "profiles"
+	KeyCurrentProfile = "current_profile"
+	ProfileEnv        = "SLEDGE_PROFILE"
+)
+
+var activeProfile string
+
+// Profiles returns the names of the profiles defined in the config file.
+func Profiles() []string {
+	var names []string
+	for name := range viper.GetStringMap(KeyProfiles) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasProfile reports whether a profile with the given name is defined.
+func HasProfile(name string) bool {
+	_, ok := viper.GetStringMap(KeyProfiles)[name]
+	return ok
+}
+
+// ApplyProfile merges the named profile over the top-level config values.
+// An empty name applies nothing.
+func ApplyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	if !HasProfile(name) {
+		return fmt.Errorf("profile %q is not defined in %s (available: %v)", name, viper.ConfigFileUsed(), Profiles())
+	}
+	if err := viper.MergeConfigMap(viper.GetStringMap(KeyProfiles + "." + name)); err != nil {
+		return fmt.Errorf("failed to apply profile %q: %v", name, err)
+	}
+	activeProfile = name
+	return nil
+}
+
+// ActiveProfile returns the name of the applied profile, or "" if none.
+func ActiveProfile() string {
+	return activeProfile
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Setting describes a configuration key sledge understands.
+type Setting struct {
+	// Key is the canonical, case-sensitive key, e.g. "migrate.pollInterval".
+	Key string
+	// Type is the pflag type of the flag bound to the key, e.g. "string",
+	// "bool", "duration", "int64" or "stringSlice".
+	Type string
+}
+
+// Problem is something wrong with a config file.
+type Problem struct {
+	Line    int
+	Key     string
+	Message string
+	// Warning problems do not stop sledge from working, e.g. keys whose
+	// case differs from the documented spelling.
+	Warning bool
+}
+
+func (p Problem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("%s: %s: %s", level, p.Key, p.Message)
+}
+
+// CheckValue reports whether value can be used for a setting of type typ.
+func CheckValue(typ, value string) error {
+	var err error
+	switch typ {
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "duration":
+		_, err = time.ParseDuration(value)
+	case "int", "int64":
+		_, err = strconv.ParseInt(value, 10, 64)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", value, typ)
+	}
+	return nil
+}
+
+// Lookup finds the setting matching key, ignoring case the way viper does.
+// exact reports whether the spelling matched as well.
+func Lookup(settings []Setting, key string) (s Setting, exact, ok bool) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, true, true
+		}
+	}
+	for _, s := range settings {
+		if strings.EqualFold(s.Key, key) {
+			return s, false, true
+		}
+	}
+	return Setting{}, false, false
+}
+
+// Suggest returns the known key closest to an unknown one, or "" if none
+// is close enough to be a likely typo.
+func Suggest(settings []Setting, key string) string {
+	best, bestDist := "", len(key)/3+1
+	for _, s := range settings {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(s.Key)); d <= bestDist {
+			best, bestDist = s.Key, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// ValidateFile checks the YAML file at path for unknown keys, misspelled
+// keys and values of the wrong type. Profiles are validated with the same
+// rules as the top level of the file.
+func ValidateFile(path string, settings []Setting) ([]Problem, error) {
+	doc, err := readYAMLNode(path)
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	validateMapping(doc.Content[0], "", settings, true, &problems)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	return problems, nil
+}
+
+func validateMapping(node *yaml.Node, prefix string, settings []Setting, top bool, problems *[]Problem) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		key := prefix + keyNode.Value
+
+		if top && prefix == "" {
+			switch strings.ToLower(keyNode.Value) {
+			case KeyCurrentProfile:
+				continue
+			case KeyProfiles:
+				validateProfiles(value, settings, problems)
+				continue
+			}
+		}
+
+		if value.Kind == yaml.MappingNode && !isSetting(settings, key) {
+			if hasSettingPrefix(settings, key+".") {
+				validateMapping(value, key+".", settings, false, problems)
+				continue
+			}
+		}
+
+		s, exact, ok := Lookup(settings, key)
+		switch {
+		case !ok:
+			msg := "unknown key"
+			if suggestion := Suggest(settings, key); suggestion != "" {
+				msg += fmt.Sprintf(" (did you mean %s?)", suggestion)
+			}
+			*problems = append(*problems, Problem{Line: keyNode.Line, Key: key, Message: msg})
+			continue
+		case !exact:
+			*problems = append(*problems, Problem{Line: keyNode.Line, Key: key, Warning: true,
+				Message: fmt.Sprintf("should be spelled %s", s.Key)})
+		}
+
+		if value.Kind != yaml.ScalarNode {
+			if value.Kind == yaml.SequenceNode && (strings.HasSuffix(s.Type, "Slice") || strings.HasSuffix(s.Type, "Array")) {
+				continue
+			}
+			*problems = append(*problems, Problem{Line: value.Line, Key: key, Message: "expected a single value"})
+			continue
+		}
+		if err := CheckValue(s.Type, value.Value); err != nil {
+			*problems = append(*problems, Problem{Line: value.Line, Key: key, Message: err.Error()})
+		}
+	}
+}
+
+func validateProfiles(node *yaml.Node, settings []Setting, problems *[]Problem) {
+	if node.Kind != yaml.MappingNode {
+		*problems = append(*problems, Problem{Line: node.Line, Key: KeyProfiles, Message: "expected a mapping of profile names"})
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, profile := node.Content[i], node.Content[i+1]
+		if profile.Kind != yaml.MappingNode {
+			*problems = append(*problems, Problem{Line: profile.Line, Key: KeyProfiles + "." + name.Value,
+				Message: "expected a mapping of settings"})
+			continue
+		}
+		var inner []Problem
+		validateMapping(profile, "", settings, false, &inner)
+		for _, p := range inner {
+			p.Key = KeyProfiles + "." + name.Value + "." + p.Key
+			*problems = append(*problems, p)
+		}
+	}
+}
+
+func isSetting(settings []Setting, key string) bool {
+	_, _, ok := Lookup(settings, key)
+	return ok
+}
+
+func hasSettingPrefix(settings []Setting, prefix string) bool {
+	for _, s := range settings {
+		if len(s.Key) > len(prefix) && strings.EqualFold(s.Key[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyLine returns the line of key in the YAML file at path, matching each
+// path segment case-insensitively, or 0 if the file does not set it.
+func KeyLine(path, key string) int {
+	doc, err := readYAMLNode(path)
+	if err != nil {
+		return 0
+	}
+	node, line := doc.Content[0], 0
+	for _, part := range strings.Split(key, ".") {
+		if node.Kind != yaml.MappingNode {
+			return 0
+		}
+		line = 0
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if strings.EqualFold(node.Content[i].Value, part) {
+				line, node = node.Content[i].Line, node.Content[i+1]
+				break
+			}
+		}
+		if line == 0 {
+			return 0
+		}
+	}
+	return line
+}
@@ -0,0 +1,957 @@
+// Package emulator serves an in-memory fake of the parts of the Cloud SQL
+// Admin API v1 REST surface that sledge uses. It is meant for demos, CI and
+// developing runbooks without touching a real GCP project.
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/engine"
+	"github.com/code4bread/sledge/logger"
+)
+
+// Options configures a Server.
+type Options struct {
+	// PendingFor is how long new operations report PENDING.
+	PendingFor time.Duration
+	// RunningFor is how long operations report RUNNING before they are DONE.
+	RunningFor time.Duration
+	// StateFile persists the emulator state between runs; empty keeps it in memory.
+	StateFile string
+	// Faults are injected errors, see Fault.
+	Faults []Fault
+	// Now overrides the clock, for tests.
+	Now func() time.Time
+}
+
+// Server is an http.Handler emulating the Cloud SQL Admin API.
+type Server struct {
+	opts   Options
+	mu     sync.Mutex
+	state  *state
+	faults []*Fault
+	mux    *http.ServeMux
+}
+
+// New creates a Server, loading any existing state from opts.StateFile.
+func New(opts Options) (*Server, error) {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	st, err := loadState(opts.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{opts: opts, state: st, mux: http.NewServeMux()}
+	for _, f := range opts.Faults {
+		s.AddFault(f)
+	}
+
+	s.mux.HandleFunc("POST /v1/projects/{project}/instances", s.insertInstance)
+	s.mux.HandleFunc("GET /v1/projects/{project}/instances", s.listInstances)
+	s.mux.HandleFunc("GET /v1/projects/{project}/instances/{instance}", s.getInstance)
+	s.mux.HandleFunc("PATCH /v1/projects/{project}/instances/{instance}", s.patchInstance)
+	s.mux.HandleFunc("DELETE /v1/projects/{project}/instances/{instance}", s.deleteInstance)
+	s.mux.HandleFunc("POST /v1/projects/{project}/instances/{instance}/restoreBackup", s.restoreBackup)
+	s.mux.HandleFunc("POST /v1/projects/{project}/instances/{instance}/backupRuns", s.insertBackupRun)
+	s.mux.HandleFunc("GET /v1/projects/{project}/instances/{instance}/backupRuns", s.listBackupRuns)
+	s.mux.HandleFunc("GET /v1/projects/{project}/instances/{instance}/backupRuns/{id}", s.getBackupRun)
+	s.mux.HandleFunc("DELETE /v1/projects/{project}/instances/{instance}/backupRuns/{id}", s.deleteBackupRun)
+	s.mux.HandleFunc("GET /v1/projects/{project}/instances/{instance}/databases", s.listDatabases)
+	s.mux.HandleFunc("POST /v1/projects/{project}/instances/{instance}/databases", s.insertDatabase)
+	s.mux.HandleFunc("GET /v1/projects/{project}/instances/{instance}/users", s.listUsers)
+	s.mux.HandleFunc("POST /v1/projects/{project}/instances/{instance}/users", s.insertUser)
+	s.mux.HandleFunc("GET /v1/projects/{project}/operations", s.listOperations)
+	s.mux.HandleFunc("GET /v1/projects/{project}/operations/{operation}", s.getOperation)
+	s.mux.HandleFunc("POST /v1/projects/{project}/operations/{operation}/cancel", s.cancelOperation)
+	return s, nil
+}
+
+// AddFault registers an injected error.
+func (s *Server) AddFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ServeHTTP implements http.Handler. Every request first advances pending
+// operations to the state they should be in at the current time.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.advance()
+	s.mu.Unlock()
+	s.mux.ServeHTTP(w, r)
+}
+
+// apiError mirrors the JSON error body returned by Google APIs so that
+// googleapi.CheckResponse decodes it into a *googleapi.Error.
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Errors  []struct {
+			Domain  string `json:"domain"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, code int, reason, format string, args ...interface{}) {
+	var body apiError
+	body.Error.Code = code
+	body.Error.Message = fmt.Sprintf(format, args...)
+	body.Error.Errors = append(body.Error.Errors, struct {
+		Domain  string `json:"domain"`
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}{"global", reason, body.Error.Message})
+	writeJSON(w, code, &body)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// reasonForCode picks the googleapi error reason used for injected faults.
+func reasonForCode(code int) string {
+	switch code {
+	case http.StatusBadRequest:
+		return "invalid"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "notFound"
+	case http.StatusConflict:
+		return "operationInProgress"
+	case http.StatusTooManyRequests:
+		return "rateLimitExceeded"
+	default:
+		return "backendError"
+	}
+}
+
+// fault checks for an injected error. It writes the response and returns
+// true for synchronous faults; asynchronous ones are returned as a message
+// for the operation to fail with. The caller must hold s.mu.
+func (s *Server) fault(w http.ResponseWriter, method, instance string) (failMessage string, handled bool) {
+	f := s.takeFault(method, instance)
+	if f == nil {
+		return "", false
+	}
+	if f.Code == 0 {
+		return f.Message, false
+	}
+	writeError(w, f.Code, reasonForCode(f.Code), "%s", f.Message)
+	return "", true
+}
+
+func (s *Server) timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// busy reports whether the instance has an unfinished operation.
+// The caller must hold s.mu.
+func (s *Server) busy(project, instance string) bool {
+	for _, rec := range s.state.Operations {
+		if !rec.Finished && rec.Op.TargetProject == project && rec.Op.TargetId == instance {
+			return true
+		}
+	}
+	return false
+}
+
+// startOperation records a new PENDING operation. The caller must hold s.mu.
+func (s *Server) startOperation(r *http.Request, project, instance, opType, effect string) *opRecord {
+	now := s.opts.Now()
+	name := uuid.NewString()
+	rec := &opRecord{
+		Op: &sqladmin.Operation{
+			Kind:          "sql#operation",
+			Name:          name,
+			OperationType: opType,
+			Status:        "PENDING",
+			InsertTime:    s.timestamp(now),
+			TargetId:      instance,
+			TargetProject: project,
+			TargetLink:    fmt.Sprintf("%s/v1/projects/%s/instances/%s", baseURL(r), project, instance),
+			SelfLink:      fmt.Sprintf("%s/v1/projects/%s/operations/%s", baseURL(r), project, name),
+			User:          "emulator@sledge.local",
+		},
+		Created: now,
+		Effect:  effect,
+	}
+	s.state.Operations = append(s.state.Operations, rec)
+	return rec
+}
+
+func baseURL(r *http.Request) string {
+	return "http://" + r.Host
+}
+
+// advance moves every unfinished operation along the PENDING→RUNNING→DONE
+// schedule and applies the effects of those that finished. The caller must
+// hold s.mu.
+func (s *Server) advance() {
+	now := s.opts.Now()
+	changed := false
+	for _, rec := range s.state.Operations {
+		if rec.Finished {
+			continue
+		}
+		started := rec.Created.Add(s.opts.PendingFor)
+		done := started.Add(s.opts.RunningFor)
+		if rec.Op.Status == "PENDING" && !now.Before(started) {
+			rec.Op.Status = "RUNNING"
+			rec.Op.StartTime = s.timestamp(started)
+			s.setBackupStatus(rec, "RUNNING")
+			changed = true
+		}
+		if rec.Op.Status == "RUNNING" && !now.Before(done) {
+			rec.Op.Status = "DONE"
+			rec.Op.EndTime = s.timestamp(done)
+			rec.Finished = true
+			s.finish(rec)
+			changed = true
+		}
+	}
+	if changed {
+		s.persist()
+	}
+}
+
+// finish applies the effect of a completed operation. The caller must hold s.mu.
+func (s *Server) finish(rec *opRecord) {
+	k := key(rec.Op.TargetProject, rec.Op.TargetId)
+	inst := s.state.Instances[k]
+	failed := rec.FailMessage != ""
+	if failed {
+		rec.Op.Error = &sqladmin.OperationErrors{
+			Kind: "sql#operationErrors",
+			Errors: []*sqladmin.OperationError{{
+				Kind:    "sql#operationError",
+				Code:    "INTERNAL_ERROR",
+				Message: rec.FailMessage,
+			}},
+		}
+	}
+
+	switch rec.Effect {
+	case effectCreate:
+		if failed {
+			delete(s.state.Instances, k)
+		} else if inst != nil {
+			inst.State = "RUNNABLE"
+		}
+	case effectUpdate, effectRestore:
+		if failed && rec.Previous != nil {
+			s.state.Instances[k] = rec.Previous
+		} else if inst != nil {
+			inst.State = "RUNNABLE"
+		}
+	case effectDelete:
+		if failed {
+			if inst != nil {
+				inst.State = "RUNNABLE"
+			}
+		} else {
+			delete(s.state.Instances, k)
+			delete(s.state.BackupRuns, k)
+			delete(s.state.Databases, k)
+			delete(s.state.Users, k)
+		}
+	case effectBackup:
+		if failed {
+			s.setBackupStatus(rec, "FAILED")
+		} else {
+			s.setBackupStatus(rec, "SUCCESSFUL")
+		}
+	case effectDatabase:
+		if failed {
+			dbs := s.state.Databases[k]
+			for i, db := range dbs {
+				if db.Name == rec.Resource {
+					s.state.Databases[k] = append(dbs[:i], dbs[i+1:]...)
+					break
+				}
+			}
+		}
+	case effectUser:
+		if failed {
+			users := s.state.Users[k]
+			for i, u := range users {
+				if u.Name == rec.Resource {
+					s.state.Users[k] = append(users[:i], users[i+1:]...)
+					break
+				}
+			}
+		}
+	case effectDeleteBackup:
+		if !failed {
+			runs := s.state.BackupRuns[k]
+			for i, br := range runs {
+				if br.Id == rec.BackupRunID {
+					s.state.BackupRuns[k] = append(runs[:i], runs[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+// setBackupStatus keeps a backup run in step with the operation creating it.
+func (s *Server) setBackupStatus(rec *opRecord, status string) {
+	if rec.Effect != effectBackup {
+		return
+	}
+	for _, br := range s.state.BackupRuns[key(rec.Op.TargetProject, rec.Op.TargetId)] {
+		if br.Id != rec.BackupRunID {
+			continue
+		}
+		br.Status = status
+		switch status {
+		case "RUNNING":
+			br.StartTime = rec.Op.StartTime
+		case "SUCCESSFUL", "FAILED":
+			br.EndTime = rec.Op.EndTime
+			if status == "FAILED" {
+				br.Error = &sqladmin.OperationError{Kind: "sql#operationError", Code: "INTERNAL_ERROR", Message: rec.FailMessage}
+			}
+		}
+	}
+}
+
+// persist saves the state if a state file is configured. The caller must hold s.mu.
+func (s *Server) persist() {
+	if err := saveState(s.opts.StateFile, s.state); err != nil {
+		// The in-memory state is still authoritative, so log rather than
+		// failing the request that triggered the save.
+		logger.Logger.Warnf("emulator: %v", err)
+	}
+}
+
+// page slices items according to the maxResults and pageToken query parameters.
+func page(r *http.Request, n int) (start, end int, next string) {
+	start, _ = strconv.Atoi(r.URL.Query().Get("pageToken"))
+	if start < 0 || start > n {
+		start = n
+	}
+	end = n
+	if max, err := strconv.Atoi(r.URL.Query().Get("maxResults")); err == nil && max > 0 && start+max < n {
+		end = start + max
+		next = strconv.Itoa(end)
+	}
+	return start, end, next
+}
+
+func (s *Server) insertInstance(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	var inst sqladmin.DatabaseInstance
+	if err := json.NewDecoder(r.Body).Decode(&inst); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failMessage, handled := s.fault(w, "instances.insert", inst.Name)
+	if handled {
+		return
+	}
+	if inst.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: instance name is required.")
+		return
+	}
+	k := key(project, inst.Name)
+	if _, ok := s.state.Instances[k]; ok {
+		writeError(w, http.StatusConflict, "instanceAlreadyExists", "The Cloud SQL instance already exists.")
+		return
+	}
+
+	if inst.Region == "" {
+		inst.Region = "us-central1"
+	}
+	if inst.Settings == nil {
+		inst.Settings = &sqladmin.Settings{}
+	}
+	if inst.Settings.Tier == "" {
+		inst.Settings.Tier = "db-f1-micro"
+	}
+	inst.Settings.SettingsVersion = 1
+	inst.UpgradableDatabaseVersions = upgradableVersions(inst.DatabaseVersion)
+	inst.Kind = "sql#instance"
+	inst.Project = project
+	inst.State = "PENDING_CREATE"
+	inst.BackendType = "SECOND_GEN"
+	inst.InstanceType = "CLOUD_SQL_INSTANCE"
+	inst.ConnectionName = fmt.Sprintf("%s:%s:%s", project, inst.Region, inst.Name)
+	inst.GceZone = inst.Region + "-a"
+	inst.Etag = uuid.NewString()
+	inst.SelfLink = fmt.Sprintf("%s/v1/projects/%s/instances/%s", baseURL(r), project, inst.Name)
+	inst.CreateTime = s.timestamp(s.opts.Now())
+	s.state.Instances[k] = &inst
+
+	rec := s.startOperation(r, project, inst.Name, "CREATE", effectCreate)
+	rec.FailMessage = failMessage
+	s.persist()
+	writeJSON(w, http.StatusOK, rec.Op)
+}
+
+func (s *Server) listInstances(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, handled := s.fault(w, "instances.list", ""); handled {
+		return
+	}
+	var items []*sqladmin.DatabaseInstance
+	for _, inst := range s.state.Instances {
+		if inst.Project == project {
+			items = append(items, inst)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	start, end, next := page(r, len(items))
+	writeJSON(w, http.StatusOK, &sqladmin.InstancesListResponse{
+		Kind:          "sql#instancesList",
+		Items:         items[start:end],
+		NextPageToken: next,
+	})
+}
+
+func (s *Server) getInstance(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, handled := s.fault(w, "instances.get", instance); handled {
+		return
+	}
+	inst, ok := s.state.Instances[key(project, instance)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "instanceDoesNotExist", "The Cloud SQL instance does not exist.")
+		return
+	}
+	writeJSON(w, http.StatusOK, inst)
+}
+
+// lookupIdle returns the instance if it exists and has no operation in
+// flight, writing the appropriate error otherwise. The caller must hold s.mu.
+func (s *Server) lookupIdle(w http.ResponseWriter, project, instance string) *sqladmin.DatabaseInstance {
+	inst, ok := s.state.Instances[key(project, instance)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "instanceDoesNotExist", "The Cloud SQL instance does not exist.")
+		return nil
+	}
+	if s.busy(project, instance) {
+		writeError(w, http.StatusConflict, "operationInProgress",
+			"Operation failed because another operation was already in progress.")
+		return nil
+	}
+	return inst
+}
+
+// patchSettingsVersion returns the settings.settingsVersion of a patch, if
+// it has a non-zero one. The API encodes it as a string.
+func patchSettingsVersion(patch map[string]interface{}) (int64, bool) {
+	settings, _ := patch["settings"].(map[string]interface{})
+	var v int64
+	switch raw := settings["settingsVersion"].(type) {
+	case string:
+		v, _ = strconv.ParseInt(raw, 10, 64)
+	case float64:
+		v = int64(raw)
+	}
+	return v, v != 0
+}
+
+// clone deep-copies an instance through its JSON representation.
+func clone(inst *sqladmin.DatabaseInstance) *sqladmin.DatabaseInstance {
+	data, _ := json.Marshal(inst)
+	var out sqladmin.DatabaseInstance
+	json.Unmarshal(data, &out)
+	return &out
+}
+
+// upgradableVersions lists the in-place upgrades of version the way the API
+// reports them in upgradableDatabaseVersions.
+func upgradableVersions(version string) []*sqladmin.AvailableDatabaseVersion {
+	var versions []*sqladmin.AvailableDatabaseVersion
+	for _, v := range engine.UpgradeTargets(version) {
+		versions = append(versions, &sqladmin.AvailableDatabaseVersion{MajorVersion: v, Name: v, DisplayName: v})
+	}
+	return versions
+}
+
+// mergePatch applies a JSON merge patch to dst, which is how PATCH treats
+// the fields present in the request body.
+func mergePatch(dst map[string]interface{}, patch map[string]interface{}) {
+	for k, v := range patch {
+		if sub, ok := v.(map[string]interface{}); ok {
+			if cur, ok := dst[k].(map[string]interface{}); ok {
+				mergePatch(cur, sub)
+				continue
+			}
+		}
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func (s *Server) patchInstance(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failMessage, handled := s.fault(w, "instances.patch", instance)
+	if handled {
+		return
+	}
+	inst := s.lookupIdle(w, project, instance)
+	if inst == nil {
+		return
+	}
+	// As in Cloud SQL, a patch carrying settingsVersion only applies to the
+	// settings it was read at.
+	if v, ok := patchSettingsVersion(patch); ok && inst.Settings != nil && v != inst.Settings.SettingsVersion {
+		writeError(w, http.StatusPreconditionFailed, "staleData",
+			"Precondition check failed: settingsVersion %d is stale, the instance is at %d.", v, inst.Settings.SettingsVersion)
+		return
+	}
+
+	previous := clone(inst)
+	current := map[string]interface{}{}
+	data, _ := json.Marshal(inst)
+	json.Unmarshal(data, &current)
+	mergePatch(current, patch)
+	data, _ = json.Marshal(current)
+	var updated sqladmin.DatabaseInstance
+	if err := json.Unmarshal(data, &updated); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: %v", err)
+		return
+	}
+	// Identity and server-managed fields cannot be changed by a patch.
+	updated.Name = previous.Name
+	updated.Project = previous.Project
+	updated.Kind = previous.Kind
+	updated.SelfLink = previous.SelfLink
+	updated.ConnectionName = previous.ConnectionName
+	updated.CreateTime = previous.CreateTime
+	if updated.Settings == nil {
+		updated.Settings = &sqladmin.Settings{}
+	}
+	opType := "UPDATE"
+	if updated.DatabaseVersion != previous.DatabaseVersion {
+		if err := engine.ValidateUpgrade(previous.DatabaseVersion, updated.DatabaseVersion); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "Invalid request: %v.", err)
+			return
+		}
+		if engine.IsMajorUpgrade(previous.DatabaseVersion, updated.DatabaseVersion) {
+			before, _ := json.Marshal(previous.Settings)
+			after, _ := json.Marshal(updated.Settings)
+			if string(before) != string(after) {
+				writeError(w, http.StatusBadRequest, "invalid",
+					"Invalid request: a major version upgrade cannot be combined with other changes.")
+				return
+			}
+			opType = "MAJOR_VERSION_UPGRADE"
+		}
+		updated.UpgradableDatabaseVersions = upgradableVersions(updated.DatabaseVersion)
+	}
+	updated.Settings.SettingsVersion = previous.Settings.SettingsVersion + 1
+	updated.Etag = uuid.NewString()
+	s.state.Instances[key(project, instance)] = &updated
+
+	rec := s.startOperation(r, project, instance, opType, effectUpdate)
+	rec.Previous = previous
+	rec.FailMessage = failMessage
+	s.persist()
+	writeJSON(w, http.StatusOK, rec.Op)
+}
+
+func (s *Server) deleteInstance(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failMessage, handled := s.fault(w, "instances.delete", instance)
+	if handled {
+		return
+	}
+	inst := s.lookupIdle(w, project, instance)
+	if inst == nil {
+		return
+	}
+	inst.State = "PENDING_DELETE"
+	rec := s.startOperation(r, project, instance, "DELETE", effectDelete)
+	rec.FailMessage = failMessage
+	s.persist()
+	writeJSON(w, http.StatusOK, rec.Op)
+}
+
+func (s *Server) restoreBackup(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	var req sqladmin.InstancesRestoreBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failMessage, handled := s.fault(w, "instances.restoreBackup", instance)
+	if handled {
+		return
+	}
+	rc := req.RestoreBackupContext
+	if rc == nil || rc.BackupRunId == 0 {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: restoreBackupContext.backupRunId is required.")
+		return
+	}
+	inst := s.lookupIdle(w, project, instance)
+	if inst == nil {
+		return
+	}
+	srcProject, srcInstance := rc.Project, rc.InstanceId
+	if srcProject == "" {
+		srcProject = project
+	}
+	if srcInstance == "" {
+		srcInstance = instance
+	}
+	var run *sqladmin.BackupRun
+	for _, br := range s.state.BackupRuns[key(srcProject, srcInstance)] {
+		if br.Id == rc.BackupRunId {
+			run = br
+		}
+	}
+	if run == nil || run.Status != "SUCCESSFUL" {
+		writeError(w, http.StatusNotFound, "backupRunDoesNotExist", "The backup run does not exist.")
+		return
+	}
+
+	previous := clone(inst)
+	inst.State = "MAINTENANCE"
+	rec := s.startOperation(r, project, instance, "RESTORE_VOLUME", effectRestore)
+	rec.Previous = previous
+	rec.BackupRunID = run.Id
+	rec.FailMessage = failMessage
+	s.persist()
+	writeJSON(w, http.StatusOK, rec.Op)
+}
+
+func (s *Server) insertBackupRun(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	var req sqladmin.BackupRun
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failMessage, handled := s.fault(w, "backupRuns.insert", instance)
+	if handled {
+		return
+	}
+	inst := s.lookupIdle(w, project, instance)
+	if inst == nil {
+		return
+	}
+
+	now := s.opts.Now()
+	run := &sqladmin.BackupRun{
+		Kind:            "sql#backupRun",
+		Id:              s.state.NextBackupID,
+		Description:     req.Description,
+		Instance:        instance,
+		Status:          "ENQUEUED",
+		Type:            "ON_DEMAND",
+		BackupKind:      "SNAPSHOT",
+		Location:        inst.Region,
+		EnqueuedTime:    s.timestamp(now),
+		WindowStartTime: s.timestamp(now),
+		SelfLink: fmt.Sprintf("%s/v1/projects/%s/instances/%s/backupRuns/%d",
+			baseURL(r), project, instance, s.state.NextBackupID),
+	}
+	s.state.NextBackupID++
+	k := key(project, instance)
+	// Backup runs are listed newest first.
+	s.state.BackupRuns[k] = append([]*sqladmin.BackupRun{run}, s.state.BackupRuns[k]...)
+
+	rec := s.startOperation(r, project, instance, "BACKUP_VOLUME", effectBackup)
+	rec.BackupRunID = run.Id
+	rec.FailMessage = failMessage
+	rec.Op.BackupContext = &sqladmin.BackupContext{Kind: "sql#backupContext", BackupId: run.Id}
+	s.persist()
+	writeJSON(w, http.StatusOK, rec.Op)
+}
+
+func (s *Server) listBackupRuns(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, handled := s.fault(w, "backupRuns.list", instance); handled {
+		return
+	}
+	if _, ok := s.state.Instances[key(project, instance)]; !ok {
+		writeError(w, http.StatusNotFound, "instanceDoesNotExist", "The Cloud SQL instance does not exist.")
+		return
+	}
+	items := s.state.BackupRuns[key(project, instance)]
+	start, end, next := page(r, len(items))
+	writeJSON(w, http.StatusOK, &sqladmin.BackupRunsListResponse{
+		Kind:          "sql#backupRunsList",
+		Items:         items[start:end],
+		NextPageToken: next,
+	})
+}
+
+// findBackupRun looks up the backup run named in the request path, writing
+// a 404 if it does not exist. The caller must hold s.mu.
+func (s *Server) findBackupRun(w http.ResponseWriter, r *http.Request) *sqladmin.BackupRun {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err == nil {
+		for _, br := range s.state.BackupRuns[key(project, instance)] {
+			if br.Id == id {
+				return br
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "backupRunDoesNotExist", "The backup run does not exist.")
+	return nil
+}
+
+func (s *Server) getBackupRun(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, handled := s.fault(w, "backupRuns.get", r.PathValue("instance")); handled {
+		return
+	}
+	if run := s.findBackupRun(w, r); run != nil {
+		writeJSON(w, http.StatusOK, run)
+	}
+}
+
+func (s *Server) deleteBackupRun(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failMessage, handled := s.fault(w, "backupRuns.delete", instance)
+	if handled {
+		return
+	}
+	run := s.findBackupRun(w, r)
+	if run == nil {
+		return
+	}
+	rec := s.startOperation(r, project, instance, "DELETE_BACKUP", effectDeleteBackup)
+	rec.BackupRunID = run.Id
+	rec.FailMessage = failMessage
+	s.persist()
+	writeJSON(w, http.StatusOK, rec.Op)
+}
+
+func (s *Server) listDatabases(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, handled := s.fault(w, "databases.list", instance); handled {
+		return
+	}
+	if _, ok := s.state.Instances[key(project, instance)]; !ok {
+		writeError(w, http.StatusNotFound, "instanceDoesNotExist", "The Cloud SQL instance does not exist.")
+		return
+	}
+	writeJSON(w, http.StatusOK, &sqladmin.DatabasesListResponse{
+		Kind:  "sql#databasesList",
+		Items: s.state.Databases[key(project, instance)],
+	})
+}
+
+func (s *Server) insertDatabase(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	var db sqladmin.Database
+	if err := json.NewDecoder(r.Body).Decode(&db); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failMessage, handled := s.fault(w, "databases.insert", instance)
+	if handled {
+		return
+	}
+	if db.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: database name is required.")
+		return
+	}
+	if s.lookupIdle(w, project, instance) == nil {
+		return
+	}
+	k := key(project, instance)
+	for _, existing := range s.state.Databases[k] {
+		if existing.Name == db.Name {
+			writeError(w, http.StatusConflict, "databaseAlreadyExists", "The database already exists.")
+			return
+		}
+	}
+	db.Kind = "sql#database"
+	db.Project = project
+	db.Instance = instance
+	db.SelfLink = fmt.Sprintf("%s/v1/projects/%s/instances/%s/databases/%s", baseURL(r), project, instance, db.Name)
+	s.state.Databases[k] = append(s.state.Databases[k], &db)
+
+	rec := s.startOperation(r, project, instance, "CREATE_DATABASE", effectDatabase)
+	rec.Resource = db.Name
+	rec.FailMessage = failMessage
+	s.persist()
+	writeJSON(w, http.StatusOK, rec.Op)
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, handled := s.fault(w, "users.list", instance); handled {
+		return
+	}
+	if _, ok := s.state.Instances[key(project, instance)]; !ok {
+		writeError(w, http.StatusNotFound, "instanceDoesNotExist", "The Cloud SQL instance does not exist.")
+		return
+	}
+	writeJSON(w, http.StatusOK, &sqladmin.UsersListResponse{
+		Kind:  "sql#usersList",
+		Items: s.state.Users[key(project, instance)],
+	})
+}
+
+func (s *Server) insertUser(w http.ResponseWriter, r *http.Request) {
+	project, instance := r.PathValue("project"), r.PathValue("instance")
+	var user sqladmin.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failMessage, handled := s.fault(w, "users.insert", instance)
+	if handled {
+		return
+	}
+	if user.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalid", "Invalid request: user name is required.")
+		return
+	}
+	if s.lookupIdle(w, project, instance) == nil {
+		return
+	}
+	k := key(project, instance)
+	for _, existing := range s.state.Users[k] {
+		if existing.Name == user.Name && existing.Host == user.Host {
+			writeError(w, http.StatusConflict, "userAlreadyExists", "The user already exists.")
+			return
+		}
+	}
+	// Like the real API, passwords are accepted but never returned.
+	user.Password = ""
+	user.Kind = "sql#user"
+	user.Project = project
+	user.Instance = instance
+	s.state.Users[k] = append(s.state.Users[k], &user)
+
+	rec := s.startOperation(r, project, instance, "CREATE_USER", effectUser)
+	rec.Resource = user.Name
+	rec.FailMessage = failMessage
+	s.persist()
+	writeJSON(w, http.StatusOK, rec.Op)
+}
+
+func (s *Server) listOperations(w http.ResponseWriter, r *http.Request) {
+	project := r.PathValue("project")
+	instance := r.URL.Query().Get("instance")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, handled := s.fault(w, "operations.list", instance); handled {
+		return
+	}
+	var items []*sqladmin.Operation
+	// Operations are listed newest first.
+	for i := len(s.state.Operations) - 1; i >= 0; i-- {
+		op := s.state.Operations[i].Op
+		if op.TargetProject == project && (instance == "" || op.TargetId == instance) {
+			items = append(items, op)
+		}
+	}
+	start, end, next := page(r, len(items))
+	writeJSON(w, http.StatusOK, &sqladmin.OperationsListResponse{
+		Kind:          "sql#operationsList",
+		Items:         items[start:end],
+		NextPageToken: next,
+	})
+}
+
+func (s *Server) getOperation(w http.ResponseWriter, r *http.Request) {
+	project, name := r.PathValue("project"), r.PathValue("operation")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, handled := s.fault(w, "operations.get", ""); handled {
+		return
+	}
+	for _, rec := range s.state.Operations {
+		if rec.Op.TargetProject == project && rec.Op.Name == name {
+			writeJSON(w, http.StatusOK, rec.Op)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "operationDoesNotExist", "The Cloud SQL operation does not exist.")
+}
+
+// cancelOperation finishes an unfinished operation immediately with an
+// error, undoing its effect the same way a failed operation would.
+func (s *Server) cancelOperation(w http.ResponseWriter, r *http.Request) {
+	project, name := r.PathValue("project"), r.PathValue("operation")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, handled := s.fault(w, "operations.cancel", ""); handled {
+		return
+	}
+	for _, rec := range s.state.Operations {
+		if rec.Op.TargetProject != project || rec.Op.Name != name {
+			continue
+		}
+		if rec.Finished {
+			writeError(w, http.StatusBadRequest, "invalidOperationState", "The operation has already completed.")
+			return
+		}
+		rec.FailMessage = "Operation was cancelled."
+		rec.Op.Status = "DONE"
+		rec.Op.EndTime = s.timestamp(s.opts.Now())
+		rec.Finished = true
+		s.finish(rec)
+		s.persist()
+		writeJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+	writeError(w, http.StatusNotFound, "operationDoesNotExist", "The Cloud SQL operation does not exist.")
+}
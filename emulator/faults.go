@@ -0,0 +1,86 @@
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fault makes the emulator fail a method instead of serving it normally.
+//
+// A Fault with a Code rejects the request itself with that HTTP status. A
+// Fault without a Code accepts the request but lets the resulting operation
+// finish with Message as its error, the way Cloud SQL reports failures that
+// only surface once the work has started.
+type Fault struct {
+	// Method is the API method to fail, e.g. "instances.restoreBackup".
+	Method string
+	// Instance restricts the fault to one instance; empty matches any.
+	Instance string
+	// Code is the HTTP status to reject the request with; 0 fails the operation instead.
+	Code int
+	// Message is the error message returned to the caller.
+	Message string
+	// Times limits how often the fault fires; 0 means every time.
+	Times int
+}
+
+// ParseFault parses the --fault syntax used by `sledge emulator`:
+//
+//	method[/instance][*times]=code:message
+//	method[/instance][*times]=op:message
+//
+// e.g. "instances.restoreBackup=400:not supported for cross region" or
+// "backupRuns.insert*1=op:backup failed".
+func ParseFault(s string) (Fault, error) {
+	var f Fault
+	target, outcome, ok := strings.Cut(s, "=")
+	if !ok {
+		return f, fmt.Errorf("invalid fault %q: expected method=code:message", s)
+	}
+	if t, n, ok := strings.Cut(target, "*"); ok {
+		times, err := strconv.Atoi(n)
+		if err != nil || times < 1 {
+			return f, fmt.Errorf("invalid fault %q: bad repeat count %q", s, n)
+		}
+		f.Times = times
+		target = t
+	}
+	f.Method, f.Instance, _ = strings.Cut(target, "/")
+	if f.Method == "" {
+		return f, fmt.Errorf("invalid fault %q: missing method", s)
+	}
+
+	code, msg, ok := strings.Cut(outcome, ":")
+	if !ok || msg == "" {
+		return f, fmt.Errorf("invalid fault %q: expected code:message", s)
+	}
+	f.Message = msg
+	if code != "op" {
+		c, err := strconv.Atoi(code)
+		if err != nil || c < 400 || c > 599 {
+			return f, fmt.Errorf("invalid fault %q: code must be an HTTP error status or \"op\"", s)
+		}
+		f.Code = c
+	}
+	return f, nil
+}
+
+// takeFault returns the first fault matching method and instance, consuming
+// one use of it. The caller must hold s.mu.
+func (s *Server) takeFault(method, instance string) *Fault {
+	for i, f := range s.faults {
+		if f.Method != method || (f.Instance != "" && f.Instance != instance) {
+			continue
+		}
+		hit := *f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return &hit
+	}
+	return nil
+}
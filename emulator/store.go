@@ -0,0 +1,119 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/api/sqladmin/v1"
+)
+
+// Operation effects, applied when an operation reaches DONE.
+const (
+	effectCreate       = "create"
+	effectUpdate       = "update"
+	effectDelete       = "delete"
+	effectBackup       = "backup"
+	effectRestore      = "restore"
+	effectDeleteBackup = "deleteBackup"
+	effectDatabase     = "database"
+	effectUser         = "user"
+)
+
+// opRecord tracks an operation together with what has to happen to the
+// emulated resources once it finishes. It is serialisable so pending work
+// survives an emulator restart when a state file is used.
+type opRecord struct {
+	Op          *sqladmin.Operation        `json:"op"`
+	Created     time.Time                  `json:"created"`
+	Effect      string                     `json:"effect"`
+	BackupRunID int64                      `json:"backupRunId,omitempty"`
+	Resource    string                     `json:"resource,omitempty"`
+	Previous    *sqladmin.DatabaseInstance `json:"previous,omitempty"`
+	FailMessage string                     `json:"failMessage,omitempty"`
+	Finished    bool                       `json:"finished"`
+}
+
+// state is everything the emulator knows about. Keys of Instances,
+// BackupRuns, Databases and Users are "project/instance".
+type state struct {
+	Instances    map[string]*sqladmin.DatabaseInstance `json:"instances"`
+	BackupRuns   map[string][]*sqladmin.BackupRun      `json:"backupRuns"`
+	Databases    map[string][]*sqladmin.Database       `json:"databases,omitempty"`
+	Users        map[string][]*sqladmin.User           `json:"users,omitempty"`
+	Operations   []*opRecord                           `json:"operations"`
+	NextBackupID int64                                 `json:"nextBackupId"`
+}
+
+func newState() *state {
+	return &state{
+		Instances:    map[string]*sqladmin.DatabaseInstance{},
+		BackupRuns:   map[string][]*sqladmin.BackupRun{},
+		Databases:    map[string][]*sqladmin.Database{},
+		Users:        map[string][]*sqladmin.User{},
+		NextBackupID: 1,
+	}
+}
+
+func key(project, instance string) string {
+	return project + "/" + instance
+}
+
+// loadState reads a state file written by saveState. A missing file yields
+// an empty state.
+func loadState(path string) (*state, error) {
+	st := newState()
+	if path == "" {
+		return st, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read emulator state %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("failed to parse emulator state %s: %v", path, err)
+	}
+	if st.Instances == nil {
+		st.Instances = map[string]*sqladmin.DatabaseInstance{}
+	}
+	if st.BackupRuns == nil {
+		st.BackupRuns = map[string][]*sqladmin.BackupRun{}
+	}
+	if st.Databases == nil {
+		st.Databases = map[string][]*sqladmin.Database{}
+	}
+	if st.Users == nil {
+		st.Users = map[string][]*sqladmin.User{}
+	}
+	return st, nil
+}
+
+// saveState atomically writes the state to path.
+func saveState(path string, st *state) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal emulator state: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sledge-emulator-*")
+	if err != nil {
+		return fmt.Errorf("failed to write emulator state: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write emulator state: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write emulator state: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
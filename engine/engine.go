@@ -0,0 +1,213 @@
+// Package engine describes the database engines Cloud SQL offers: their
+// versions, SQL Server editions and the machine tiers each engine accepts.
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Engine is a Cloud SQL database engine.
+type Engine string
+
+const (
+	MySQL     Engine = "mysql"
+	Postgres  Engine = "postgres"
+	SQLServer Engine = "sqlserver"
+)
+
+// All lists the supported engines.
+var All = []Engine{MySQL, Postgres, SQLServer}
+
+// SQL Server editions, the suffix of SQLSERVER_* versions.
+var Editions = []string{"STANDARD", "ENTERPRISE", "EXPRESS", "WEB"}
+
+var catalog = map[Engine]struct {
+	prefix         string
+	versions       []string
+	defaultVersion string
+	defaultTier    string
+}{
+	MySQL: {
+		prefix:         "MYSQL_",
+		versions:       []string{"MYSQL_5_6", "MYSQL_5_7", "MYSQL_8_0", "MYSQL_8_4"},
+		defaultVersion: "MYSQL_8_0",
+		defaultTier:    "db-f1-micro",
+	},
+	Postgres: {
+		prefix: "POSTGRES_",
+		versions: []string{"POSTGRES_9_6", "POSTGRES_10", "POSTGRES_11", "POSTGRES_12", "POSTGRES_13",
+			"POSTGRES_14", "POSTGRES_15", "POSTGRES_16", "POSTGRES_17"},
+		defaultVersion: "POSTGRES_16",
+		defaultTier:    "db-f1-micro",
+	},
+	SQLServer: {
+		prefix:         "SQLSERVER_",
+		versions:       sqlServerVersions("2017", "2019", "2022"),
+		defaultVersion: "SQLSERVER_2019_STANDARD",
+		defaultTier:    "db-custom-2-7680",
+	},
+}
+
+func sqlServerVersions(years ...string) []string {
+	var versions []string
+	for _, year := range years {
+		for _, edition := range Editions {
+			versions = append(versions, "SQLSERVER_"+year+"_"+edition)
+		}
+	}
+	return versions
+}
+
+// mysqlMinor matches MySQL minor versions such as MYSQL_8_0_36.
+var mysqlMinor = regexp.MustCompile(`^MYSQL_8_0_\d+$`)
+
+// Parse returns the engine with the given name, e.g. "postgres".
+func Parse(name string) (Engine, error) {
+	switch strings.ToLower(name) {
+	case "mysql":
+		return MySQL, nil
+	case "postgres", "postgresql":
+		return Postgres, nil
+	case "sqlserver", "mssql":
+		return SQLServer, nil
+	}
+	return "", fmt.Errorf("unknown engine %q (want mysql, postgres or sqlserver)", name)
+}
+
+// FromVersion returns the engine of a database version, e.g. Postgres for
+// POSTGRES_16.
+func FromVersion(version string) (Engine, error) {
+	for _, e := range All {
+		if strings.HasPrefix(version, catalog[e].prefix) {
+			return e, nil
+		}
+	}
+	return "", fmt.Errorf("unknown database version %q (want MYSQL_*, POSTGRES_* or SQLSERVER_*)", version)
+}
+
+// Versions lists the database versions of the engine, oldest first.
+func (e Engine) Versions() []string { return catalog[e].versions }
+
+// DefaultVersion is the version used when none is given.
+func (e Engine) DefaultVersion() string { return catalog[e].defaultVersion }
+
+// DefaultTier is the tier used when none is given.
+func (e Engine) DefaultTier() string { return catalog[e].defaultTier }
+
+// ValidateVersion checks that version exists for the engine.
+func (e Engine) ValidateVersion(version string) error {
+	if owner, err := FromVersion(version); err != nil {
+		return err
+	} else if owner != e {
+		return fmt.Errorf("database version %s is a %s version, not %s", version, owner, e)
+	}
+	if e == MySQL && mysqlMinor.MatchString(version) {
+		return nil
+	}
+	for _, v := range e.Versions() {
+		if v == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %s version %s (known: %s)", e, version, strings.Join(e.Versions(), ", "))
+}
+
+// WithEdition applies a SQL Server edition to version: SQLSERVER_2019 and
+// edition ENTERPRISE give SQLSERVER_2019_ENTERPRISE. A version that already
+// names an edition must agree with it. Other engines have no editions.
+func (e Engine) WithEdition(version, edition string) (string, error) {
+	if edition == "" {
+		return version, nil
+	}
+	if e != SQLServer {
+		return "", fmt.Errorf("--edition only applies to sqlserver, not %s", e)
+	}
+	edition = strings.ToUpper(edition)
+	valid := false
+	for _, ed := range Editions {
+		valid = valid || ed == edition
+	}
+	if !valid {
+		return "", fmt.Errorf("unknown SQL Server edition %q (want one of %s)", edition, strings.Join(Editions, ", "))
+	}
+	parts := strings.Split(version, "_")
+	switch len(parts) {
+	case 2: // SQLSERVER_2019
+		return version + "_" + edition, nil
+	case 3:
+		if parts[2] != edition {
+			return "", fmt.Errorf("database version %s conflicts with edition %s", version, edition)
+		}
+		return version, nil
+	}
+	return "", fmt.Errorf("invalid SQL Server version %q", version)
+}
+
+// Custom machine shape limits, see
+// https://cloud.google.com/sql/docs/mysql/instance-settings#machine-type-2ndgen
+const (
+	maxCPUs           = 96
+	minMemoryMB       = 3840
+	minMemoryPerCPUMB = 922  // 0.9 GB
+	maxMemoryPerCPUMB = 6656 // 6.5 GB
+	memoryStepMB      = 256
+)
+
+var customTier = regexp.MustCompile(`^db-custom-(\d+)-(\d+)$`)
+
+// ParseCustomTier returns the vCPUs and memory (MB) of a db-custom-CPU-RAM
+// tier. ok is false if tier is not a custom tier.
+func ParseCustomTier(tier string) (cpus, memoryMB int, ok bool) {
+	m := customTier.FindStringSubmatch(tier)
+	if m == nil {
+		return 0, 0, false
+	}
+	cpus, _ = strconv.Atoi(m[1])
+	memoryMB, _ = strconv.Atoi(m[2])
+	return cpus, memoryMB, true
+}
+
+// predefinedTier matches the predefined machine series, e.g.
+// db-n1-standard-4 or db-perf-optimized-N-8.
+var predefinedTier = regexp.MustCompile(`^db-(n1-standard|n1-highmem|perf-optimized-N)-\d+$`)
+
+// ValidateTier checks that tier is a machine type the engine can run on:
+// a shared-core tier (not SQL Server), a predefined series (MySQL and
+// PostgreSQL) or a custom db-custom-CPU-RAM shape within the CPU and memory
+// limits.
+func (e Engine) ValidateTier(tier string) error {
+	switch {
+	case tier == "db-f1-micro" || tier == "db-g1-small":
+		if e == SQLServer {
+			return fmt.Errorf("shared-core tier %s is not available for SQL Server; use db-custom-CPU-RAM", tier)
+		}
+		return nil
+	case predefinedTier.MatchString(tier):
+		if e == SQLServer {
+			return fmt.Errorf("tier %s is not available for SQL Server; use db-custom-CPU-RAM", tier)
+		}
+		return nil
+	}
+
+	cpus, memoryMB, ok := ParseCustomTier(tier)
+	if !ok {
+		return fmt.Errorf("invalid tier %q (want db-f1-micro, db-g1-small, db-n1-standard-N, db-custom-CPU-RAM_MB, ...)", tier)
+	}
+	switch {
+	case cpus < 1 || cpus > maxCPUs || (cpus > 1 && cpus%2 != 0):
+		return fmt.Errorf("tier %s: vCPUs must be 1 or an even number up to %d", tier, maxCPUs)
+	case e == SQLServer && cpus < 2:
+		return fmt.Errorf("tier %s: SQL Server needs at least 2 vCPUs", tier)
+	case memoryMB%memoryStepMB != 0:
+		return fmt.Errorf("tier %s: memory must be a multiple of %d MB", tier, memoryStepMB)
+	case memoryMB < minMemoryMB:
+		return fmt.Errorf("tier %s: memory must be at least %d MB", tier, minMemoryMB)
+	case memoryMB < cpus*minMemoryPerCPUMB || memoryMB > cpus*maxMemoryPerCPUMB:
+		return fmt.Errorf("tier %s: memory must be between %d and %d MB for %d vCPUs",
+			tier, cpus*minMemoryPerCPUMB, cpus*maxMemoryPerCPUMB, cpus)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Upgrade paths Cloud SQL supports in place, see
+// https://cloud.google.com/sql/docs/mysql/upgrade-major-db-version-inplace
+// and its PostgreSQL and SQL Server counterparts:
+//
+//   - MySQL one major version at a time, 5.6 → 5.7 → 8.0 → 8.4, and to a
+//     later 8.0 minor version (MYSQL_8_0_N) from 5.7 or 8.0;
+//   - PostgreSQL to any later major version;
+//   - SQL Server to a later year of the same edition.
+var mysqlNextMajor = map[string]string{
+	"MYSQL_5_6": "MYSQL_5_7",
+	"MYSQL_5_7": "MYSQL_8_0",
+	"MYSQL_8_0": "MYSQL_8_4",
+}
+
+// removedFlags lists database flags a version no longer accepts. Upgrading
+// past the version with such a flag set fails or silently drops the flag.
+var removedFlags = map[string][]string{
+	"MYSQL_8_0": {"query_cache_type", "query_cache_size", "query_cache_limit", "innodb_file_format",
+		"innodb_large_prefix", "tx_isolation", "tx_read_only", "log_warnings"},
+	"MYSQL_8_4":   {"default_authentication_plugin", "expire_logs_days", "avoid_temporal_upgrade", "show_old_temporals"},
+	"POSTGRES_13": {"wal_keep_segments"},
+	"POSTGRES_14": {"vacuum_cleanup_index_scale_factor", "operator_precedence_warning"},
+	"POSTGRES_15": {"stats_temp_directory"},
+	"POSTGRES_16": {"force_parallel_mode", "promote_trigger_file", "vacuum_defer_cleanup_age"},
+	"POSTGRES_17": {"old_snapshot_threshold", "db_user_namespace", "trace_recovery_messages"},
+}
+
+// major returns the major version of version and, for MySQL minor
+// versions such as MYSQL_8_0_36, the minor number (-1 otherwise).
+func major(version string) (string, int) {
+	if mysqlMinor.MatchString(version) {
+		minor, _ := strconv.Atoi(version[strings.LastIndex(version, "_")+1:])
+		return "MYSQL_8_0", minor
+	}
+	return version, -1
+}
+
+// rank orders the versions of an engine, oldest first. It is -1 for
+// versions the catalog does not know.
+func (e Engine) rank(version string) int {
+	m, _ := major(version)
+	if e == SQLServer {
+		// Editions do not order; only the year does.
+		m = m[:strings.LastIndex(m, "_")]
+	}
+	for i, v := range e.Versions() {
+		if e == SQLServer {
+			v = v[:strings.LastIndex(v, "_")]
+		}
+		if v == m {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsMajorUpgrade reports whether moving from one version to another changes
+// the major version, which Cloud SQL runs as a MAJOR_VERSION_UPGRADE
+// operation that cannot be combined with other changes. MySQL minor
+// upgrades within 8.0 are not major.
+func IsMajorUpgrade(from, to string) bool {
+	fromMajor, _ := major(from)
+	toMajor, _ := major(to)
+	return fromMajor != toMajor
+}
+
+// ValidateUpgrade checks that an instance at version from can be upgraded
+// in place to version to, rejecting unknown versions, engine changes,
+// downgrades and jumps Cloud SQL does not support. Equal versions are not
+// an upgrade and pass.
+func ValidateUpgrade(from, to string) error {
+	if from == to {
+		return nil
+	}
+	e, err := FromVersion(from)
+	if err != nil {
+		return err
+	}
+	if toEngine, err := FromVersion(to); err != nil {
+		return err
+	} else if toEngine != e {
+		return fmt.Errorf("cannot upgrade %s to %s: a %s instance cannot become %s; migrate the data to a new instance instead",
+			from, to, e, toEngine)
+	}
+	// An unknown version has no rank, so it would pass the downgrade and
+	// skip checks below whatever it is.
+	if err := e.ValidateVersion(from); err != nil {
+		return err
+	}
+	if err := e.ValidateVersion(to); err != nil {
+		return err
+	}
+
+	fromMajor, fromMinor := major(from)
+	toMajor, toMinor := major(to)
+	fromRank, toRank := e.rank(from), e.rank(to)
+	if toRank < fromRank || (toRank == fromRank && toMinor < fromMinor) {
+		return fmt.Errorf("cannot upgrade %s to %s: it is a downgrade, which Cloud SQL cannot do in place; restore a backup taken before the upgrade instead",
+			from, to)
+	}
+
+	switch e {
+	case MySQL:
+		next := mysqlNextMajor[fromMajor]
+		switch {
+		case fromMajor == toMajor || next == toMajor:
+			return nil
+		case next == "":
+			return fmt.Errorf("cannot upgrade %s in place", from)
+		}
+		return fmt.Errorf("cannot upgrade %s to %s directly: MySQL upgrades one major version at a time; upgrade to %s first",
+			from, to, next)
+	case SQLServer:
+		if from[strings.LastIndex(from, "_"):] != to[strings.LastIndex(to, "_"):] {
+			return fmt.Errorf("cannot upgrade %s to %s: an in-place upgrade keeps the SQL Server edition", from, to)
+		}
+	}
+	return nil
+}
+
+// UpgradeTargets lists the versions an instance at version can be upgraded
+// to in place, oldest first. MySQL 8.0 minor versions are not listed.
+func UpgradeTargets(version string) []string {
+	e, err := FromVersion(version)
+	if err != nil {
+		return nil
+	}
+	var targets []string
+	for _, v := range e.Versions() {
+		if v != version && ValidateUpgrade(version, v) == nil {
+			targets = append(targets, v)
+		}
+	}
+	return targets
+}
+
+// IncompatibleFlags returns, for each of the flags that a version between
+// from (exclusive) and to (inclusive) removed, why it is incompatible.
+func IncompatibleFlags(from, to string, flags []string) []string {
+	e, err := FromVersion(from)
+	if err != nil {
+		return nil
+	}
+	fromRank, toRank := e.rank(from), e.rank(to)
+	var problems []string
+	for _, v := range e.Versions() {
+		if r := e.rank(v); r <= fromRank || r > toRank {
+			continue
+		}
+		for _, removed := range removedFlags[v] {
+			for _, f := range flags {
+				if f == removed {
+					problems = append(problems, fmt.Sprintf("database flag %s is not supported from %s on", f, v))
+				}
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,190 @@
+// Package errkind classifies the errors sledge returns so callers can tell
+// failures apart, and maps each class to a stable process exit code.
+package errkind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+
+	"github.com/code4bread/sledge/waiter"
+)
+
+// Kind is the class of a failure.
+type Kind int
+
+const (
+	// Unknown is any failure not covered by the other kinds.
+	Unknown Kind = iota
+	// Validation means the command was given missing or invalid input.
+	Validation
+	// NotFound means the instance, operation or backup run does not exist.
+	NotFound
+	// AlreadyExists means the resource to create exists already.
+	AlreadyExists
+	// PermissionDenied means the caller is not authenticated or authorised.
+	PermissionDenied
+	// Quota means a quota or rate limit was exceeded.
+	Quota
+	// Conflict means another operation is in progress on the instance, or
+	// the instance changed since it was read.
+	Conflict
+	// Timeout means an operation did not finish in time.
+	Timeout
+	// OperationFailed means an operation finished with errors.
+	OperationFailed
+	// Interrupted means SIGINT or SIGTERM stopped the command.
+	Interrupted
+	// ChangesPending is not a failure: a plan found changes still to be
+	// made, or instances drifted from their specs. It gets its own exit code
+	// so pipelines can tell "nothing to do" from "review needed".
+	ChangesPending
+)
+
+var names = map[Kind]string{
+	Unknown:          "Unknown",
+	Validation:       "Validation",
+	NotFound:         "NotFound",
+	AlreadyExists:    "AlreadyExists",
+	PermissionDenied: "PermissionDenied",
+	Quota:            "Quota",
+	Conflict:         "Conflict",
+	Timeout:          "Timeout",
+	OperationFailed:  "OperationFailed",
+	Interrupted:      "Interrupted",
+	ChangesPending:   "ChangesPending",
+}
+
+func (k Kind) String() string { return names[k] }
+
+// exitCodes is the documented exit code of every kind. Keep README.md in
+// sync when changing it; scripts depend on these values.
+var exitCodes = map[Kind]int{
+	Unknown:          1,
+	Validation:       2,
+	NotFound:         3,
+	AlreadyExists:    4,
+	PermissionDenied: 5,
+	Quota:            6,
+	Conflict:         7,
+	Timeout:          8,
+	OperationFailed:  9,
+	Interrupted:      130,
+	ChangesPending:   10,
+}
+
+// ExitCode returns the process exit code for the kind.
+func (k Kind) ExitCode() int { return exitCodes[k] }
+
+// ErrInterrupted is wrapped by errors returned when SIGINT or SIGTERM
+// stopped a command.
+var ErrInterrupted = errors.New("interrupted")
+
+// Error attaches a Kind to an error.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns err classified as kind.
+func New(kind Kind, err error) error {
+	return &Error{Kind: kind, Err: err}
+}
+
+// Validationf returns a Validation error with a formatted message.
+func Validationf(format string, args ...interface{}) error {
+	return New(Validation, fmt.Errorf(format, args...))
+}
+
+// Of classifies err by the first error in its chain that carries a kind:
+// an *Error, a *googleapi.Error or one of the waiter's errors.
+func Of(err error) Kind {
+	if err == nil {
+		return Unknown
+	}
+	if errors.Is(err, ErrInterrupted) {
+		return Interrupted
+	}
+	var kerr *Error
+	if errors.As(err, &kerr) {
+		return kerr.Kind
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return fromAPIError(gerr)
+	}
+	var terr *waiter.TimeoutError
+	if errors.As(err, &terr) || errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	var oerr *waiter.OperationError
+	if errors.As(err, &oerr) {
+		return OperationFailed
+	}
+	return Unknown
+}
+
+// Is reports whether err is of the given kind.
+func Is(err error, kind Kind) bool {
+	return err != nil && Of(err) == kind
+}
+
+// ExitCode returns the process exit code for err, 0 if it is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return Of(err).ExitCode()
+}
+
+// fromAPIError classifies an API error by its HTTP status and reason.
+func fromAPIError(e *googleapi.Error) Kind {
+	switch e.Code {
+	case http.StatusBadRequest:
+		return Validation
+	case http.StatusUnauthorized:
+		return PermissionDenied
+	case http.StatusForbidden:
+		if hasReason(e, "quota", "ratelimit") {
+			return Quota
+		}
+		return PermissionDenied
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusConflict:
+		if hasReason(e, "exists") {
+			return AlreadyExists
+		}
+		return Conflict
+	case http.StatusPreconditionFailed:
+		return Conflict
+	case http.StatusTooManyRequests:
+		return Quota
+	case http.StatusGatewayTimeout:
+		return Timeout
+	}
+	return Unknown
+}
+
+// hasReason reports whether any reason of e contains one of the fragments,
+// ignoring case; e.g. "alreadyExists" and "instanceAlreadyExists" both
+// contain "exists".
+func hasReason(e *googleapi.Error, fragments ...string) bool {
+	for _, item := range e.Errors {
+		reason := strings.ToLower(item.Reason)
+		for _, f := range fragments {
+			if strings.Contains(reason, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
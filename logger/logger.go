@@ -2,39 +2,71 @@
 package logger
 
 import (
-    "github.com/sirupsen/logrus"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
 )
 
-// Logger is a globally accessible logger instance.
+// Logger is a globally accessible logger instance. It writes to stderr so
+// that command output on stdout stays parseable.
 var Logger = logrus.New()
 
+// Formats and Levels are the values accepted by SetFormatter and SetLevel.
+var (
+	Formats = []string{"text", "json"}
+	Levels  = []string{"debug", "info", "warn", "error"}
+)
+
 func init() {
-    SetFormatter("text") // Default formatter
-    SetLevel("info")     // Default level
+	Logger.SetOutput(os.Stderr)
+	SetFormatter("text") // Default formatter
+	SetLevel("info")     // Default level
 }
 
 // SetFormatter allows dynamic configuration of the log formatter.
 func SetFormatter(format string) {
-    switch format {
-    case "json":
-        Logger.SetFormatter(&logrus.JSONFormatter{})
-    default:
-        Logger.SetFormatter(&logrus.TextFormatter{
-            FullTimestamp: true,
-        })
-    }
+	switch format {
+	case "json":
+		Logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		Logger.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+		})
+	}
 }
 
 // SetLevel sets the logging level based on a string input.
 func SetLevel(level string) {
-    switch level {
-    case "debug":
-        Logger.SetLevel(logrus.DebugLevel)
-    case "warn":
-        Logger.SetLevel(logrus.WarnLevel)
-    case "error":
-        Logger.SetLevel(logrus.ErrorLevel)
-    default:
-        Logger.SetLevel(logrus.InfoLevel)
-    }
+	switch level {
+	case "debug":
+		Logger.SetLevel(logrus.DebugLevel)
+	case "warn":
+		Logger.SetLevel(logrus.WarnLevel)
+	case "error":
+		Logger.SetLevel(logrus.ErrorLevel)
+	default:
+		Logger.SetLevel(logrus.InfoLevel)
+	}
+}
+
+// Validate reports an error if format or level is not one SetFormatter or
+// SetLevel understands, instead of silently falling back to the default.
+func Validate(format, level string) error {
+	if !contains(Formats, format) {
+		return fmt.Errorf("unknown log format %q (want one of %v)", format, Formats)
+	}
+	if !contains(Levels, level) {
+		return fmt.Errorf("unknown log level %q (want one of %v)", level, Levels)
+	}
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
 }
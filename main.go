@@ -1,13 +1,22 @@
 package main
 
 import (
+	"os"
+
 	"github.com/code4bread/sledge/cmd"
-	"github.com/sirupsen/logrus"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/logger"
 )
 
 func main() {
-	log := logrus.New()
 	if err := cmd.Execute(); err != nil {
-		log.Fatal(err)
+		entry := logger.Logger.WithField("kind", errkind.Of(err))
+		if errkind.Is(err, errkind.ChangesPending) {
+			// A plan with changes succeeded; only the exit code differs.
+			entry.Info(err)
+		} else {
+			entry.Error(err)
+		}
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -0,0 +1,162 @@
+// Package output renders command results as JSON, YAML, a table, CSV or a
+// Go template, as selected with the global --output flag.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format names accepted by Parse. Templates are given as template=TEXT
+// (or go-template=TEXT).
+const (
+	JSON     = "json"
+	YAML     = "yaml"
+	Table    = "table"
+	Wide     = "wide"
+	CSV      = "csv"
+	Template = "template"
+)
+
+// Format is a parsed --output value.
+type Format struct {
+	Name     string
+	template *template.Template
+}
+
+// Parse parses an --output value. An empty value yields the zero Format,
+// which callers treat as "use the command's default".
+func Parse(s string) (Format, error) {
+	name, text, hasText := strings.Cut(s, "=")
+	switch name {
+	case "":
+		return Format{}, nil
+	case JSON, YAML, Table, Wide, CSV:
+		if hasText {
+			return Format{}, fmt.Errorf("output format %s takes no argument", name)
+		}
+		return Format{Name: name}, nil
+	case Template, "go-template":
+		if text == "" {
+			return Format{}, fmt.Errorf("output format %s needs a template, e.g. %s='{{.operation}}'", name, name)
+		}
+		tmpl, err := template.New("output").Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return Format{}, fmt.Errorf("invalid output template: %v", err)
+		}
+		return Format{Name: Template, template: tmpl}, nil
+	default:
+		return Format{}, fmt.Errorf("unknown output format %q (want json, yaml, table, wide, csv or template=...)", s)
+	}
+}
+
+// TableFunc returns the header and rows of a table. wide asks for the
+// additional columns shown by -o wide and -o csv.
+type TableFunc func(wide bool) (header []string, rows [][]string)
+
+// Write renders v to w in format f. table renders the table formats and may
+// be nil for results that have no table view. Templates and YAML see the
+// same field names as the JSON output.
+func Write(w io.Writer, f Format, v interface{}, table TableFunc) error {
+	switch f.Name {
+	case JSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal output: %v", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case YAML:
+		return writeYAML(w, v)
+	case Table, Wide:
+		if table == nil {
+			return fmt.Errorf("output format %s is not supported by this command", f.Name)
+		}
+		header, rows := table(f.Name == Wide)
+		return writeTable(w, header, rows)
+	case CSV:
+		if table == nil {
+			return fmt.Errorf("output format %s is not supported by this command", f.Name)
+		}
+		// CSV is meant for other programs, so it has every column.
+		header, rows := table(true)
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	case Template:
+		generic, err := toGeneric(v)
+		if err != nil {
+			return err
+		}
+		if err := f.template.Execute(w, generic); err != nil {
+			return fmt.Errorf("failed to execute output template: %v", err)
+		}
+		_, err = fmt.Fprintln(w)
+		return err
+	default:
+		return fmt.Errorf("no output format selected")
+	}
+}
+
+// toGeneric round-trips v through JSON so templates use the JSON field names.
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal output: %v", err)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("failed to decode output: %v", err)
+	}
+	return generic, nil
+}
+
+// writeYAML converts the JSON encoding of v to block-style YAML, keeping
+// the field order of the JSON output.
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %v", err)
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("failed to convert output to YAML: %v", err)
+	}
+	clearStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return fmt.Errorf("failed to encode YAML output: %v", err)
+	}
+	enc.Close()
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// clearStyle drops the flow and quoting styles JSON input leaves on nodes.
+func clearStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		clearStyle(c)
+	}
+}
+
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,185 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/sqladmin/v1"
+)
+
+// Change is a field that differs between two instances. Path is the dotted
+// JSON path of the field, e.g. settings.backupConfiguration.startTime; Old
+// and New are nil when the field is unset. Downtime marks changes that
+// restart the instance or take it offline, with Reason saying why.
+type Change struct {
+	Path     string      `json:"path"`
+	Old      interface{} `json:"old,omitempty"`
+	New      interface{} `json:"new,omitempty"`
+	Downtime bool        `json:"downtime,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s: %s -> %s", c.Path, FormatValue(c.Old), FormatValue(c.New))
+	if c.Downtime {
+		s += " (downtime: " + c.Reason + ")"
+	}
+	return s
+}
+
+// FormatValue renders a Change value for people: strings as they are,
+// anything else as JSON, and unset values as "(unset)".
+func FormatValue(v interface{}) string {
+	if isZero(v) {
+		return "(unset)"
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// Diff compares two values through their JSON representation and returns
+// the fields that differ, sorted by path. Objects are compared field by
+// field; lists are compared as a whole. Unset and zero values are equal,
+// so a field only one side sends as false or 0 is not a change. Changes to
+// instance fields known to cause downtime are marked as such.
+func Diff(old, new interface{}) []Change {
+	var changes []Change
+	diffValues("", toGeneric(old), toGeneric(new), &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	for i := range changes {
+		changes[i].Reason = downtimeReason(changes[i].Path)
+		changes[i].Downtime = changes[i].Reason != ""
+	}
+	return changes
+}
+
+// HasDowntime reports whether any of the changes causes downtime.
+func HasDowntime(changes []Change) bool {
+	for _, c := range changes {
+		if c.Downtime {
+			return true
+		}
+	}
+	return false
+}
+
+func toGeneric(v interface{}) interface{} {
+	data, _ := json.Marshal(v)
+	var out interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func diffValues(path string, a, b interface{}, changes *[]Change) {
+	am, aIsMap := a.(map[string]interface{})
+	bm, bIsMap := b.(map[string]interface{})
+	if (aIsMap || a == nil) && (bIsMap || b == nil) && (aIsMap || bIsMap) {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		for k := range keys {
+			diffValues(joinPath(path, k), am[k], bm[k], changes)
+		}
+		return
+	}
+	if isZero(a) && isZero(b) || reflect.DeepEqual(a, b) {
+		return
+	}
+	*changes = append(*changes, Change{Path: path, Old: a, New: b})
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func isZero(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		for _, e := range v {
+			if !isZero(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Patch builds the body of an Instances.Patch request that turns current
+// into desired given their changes: only the top-level instance fields and
+// the settings that changed are sent. A changed settings structure, such as
+// backupConfiguration, is sent whole from desired, so its unchanged fields
+// are restated rather than relying on how the API merges nested objects.
+func Patch(desired *sqladmin.DatabaseInstance, changes []Change) *sqladmin.DatabaseInstance {
+	patch := &sqladmin.DatabaseInstance{}
+	for _, c := range changes {
+		top, rest, _ := strings.Cut(c.Path, ".")
+		if top != "settings" {
+			copyJSONField(patch, desired, top)
+			continue
+		}
+		if patch.Settings == nil {
+			patch.Settings = &sqladmin.Settings{}
+		}
+		field, _, _ := strings.Cut(rest, ".")
+		copyJSONField(patch.Settings, desired.Settings, field)
+	}
+	return patch
+}
+
+// Guard sets the settingsVersion of current, the instance patch was
+// computed from, on patch. The API then rejects the patch with 412
+// Precondition Failed if the instance changed since current was read,
+// rather than applying it over the other change.
+func Guard(patch, current *sqladmin.DatabaseInstance) *sqladmin.DatabaseInstance {
+	if current.Settings == nil || current.Settings.SettingsVersion == 0 {
+		return patch
+	}
+	if patch.Settings == nil {
+		patch.Settings = &sqladmin.Settings{}
+	}
+	patch.Settings.SettingsVersion = current.Settings.SettingsVersion
+	return patch
+}
+
+// copyJSONField copies the field whose JSON name is name from src to dst,
+// both pointers to the same struct type, and forces it to be sent even if
+// it is a zero value, e.g. deletionProtectionEnabled turned off.
+func copyJSONField(dst, src interface{}, name string) {
+	dv, sv := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	t := dv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag != name {
+			continue
+		}
+		dv.Field(i).Set(sv.Field(i))
+		if force := dv.FieldByName("ForceSendFields"); force.IsValid() && sv.Field(i).IsZero() {
+			force.Set(reflect.ValueOf(forceSend(force.Interface().([]string), t.Field(i).Name)))
+		}
+		return
+	}
+}
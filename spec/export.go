@@ -0,0 +1,187 @@
+package spec
+
+import (
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/engine"
+)
+
+// API defaults Export leaves out, so a spec only states what was chosen.
+const (
+	defaultDiskType        = "PD_SSD"
+	defaultAvailability    = "ZONAL"
+	defaultRetainedBackups = 7
+	defaultLogRetention    = 7
+	defaultSSLMode         = "ALLOW_UNENCRYPTED_AND_ENCRYPTED"
+	defaultMySQLHost       = "%"
+)
+
+// systemDatabases and systemUsers exist on every instance of an engine and
+// are managed by Cloud SQL; specs never list them.
+var (
+	systemDatabases = map[engine.Engine][]string{
+		engine.MySQL:     {"information_schema", "mysql", "performance_schema", "sys"},
+		engine.Postgres:  {"postgres", "cloudsqladmin"},
+		engine.SQLServer: {"master", "model", "msdb", "tempdb"},
+	}
+	systemUsers = map[engine.Engine][]string{
+		engine.MySQL:     {"root", "mysql.sys", "mysql.session", "mysql.infoschema"},
+		engine.Postgres:  {"postgres", "cloudsqladmin", "cloudsqlsuperuser"},
+		engine.SQLServer: {"sqlserver"},
+	}
+	defaultCharsets   = map[string]bool{"utf8mb4": true, "UTF8": true}
+	defaultCollations = map[string]bool{"utf8mb4_0900_ai_ci": true, "en_US.UTF8": true, "SQL_Latin1_General_CP1_CI_AS": true}
+	notEnvChar        = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+// Export turns a live instance, with its databases and users, into the
+// minimal spec that describes it: server-managed fields such as etag,
+// ipAddresses or settingsVersion, API defaults and the databases and users
+// Cloud SQL creates itself are left out. Applying the result to the same
+// instance changes nothing.
+//
+// Passwords cannot be read back, so built-in users and SQL Server's root
+// get a passwordEnv named after the instance and user, e.g.
+// ORDERS_DB_APP_PASSWORD, for whoever recreates them to set.
+func Export(inst *sqladmin.DatabaseInstance, databases []*sqladmin.Database, users []*sqladmin.User) *Instance {
+	eng, _ := engine.FromVersion(inst.DatabaseVersion)
+	i := &Instance{
+		Name:            inst.Name,
+		Project:         inst.Project,
+		Region:          inst.Region,
+		DatabaseVersion: inst.DatabaseVersion,
+	}
+	if eng == engine.SQLServer {
+		i.RootPasswordEnv = envName(inst.Name, "root", "password")
+	}
+	if inst.Settings != nil {
+		i.Settings = exportSettings(inst.Settings, eng)
+	}
+
+	for _, db := range databases {
+		if contains(systemDatabases[eng], db.Name) {
+			continue
+		}
+		d := Database{Name: db.Name}
+		if !defaultCharsets[db.Charset] {
+			d.Charset = db.Charset
+		}
+		if !defaultCollations[db.Collation] {
+			d.Collation = db.Collation
+		}
+		i.Databases = append(i.Databases, d)
+	}
+	for _, user := range users {
+		if contains(systemUsers[eng], user.Name) {
+			continue
+		}
+		u := User{Name: user.Name}
+		if eng == engine.MySQL && user.Host != defaultMySQLHost {
+			u.Host = user.Host
+		}
+		if user.Type != "" && user.Type != "BUILT_IN" {
+			u.Type = user.Type
+		} else {
+			u.PasswordEnv = envName(inst.Name, user.Name, "password")
+		}
+		i.Users = append(i.Users, u)
+	}
+	return i
+}
+
+func exportSettings(src *sqladmin.Settings, eng engine.Engine) Settings {
+	s := Settings{
+		Tier:               src.Tier,
+		Labels:             src.UserLabels,
+		DeletionProtection: onlyTrue(src.DeletionProtectionEnabled),
+	}
+
+	s.Storage.SizeGB = src.DataDiskSizeGb
+	if src.DataDiskType != defaultDiskType {
+		s.Storage.Type = strings.TrimPrefix(src.DataDiskType, "PD_")
+	}
+	if src.StorageAutoResize != nil && !*src.StorageAutoResize {
+		s.Storage.AutoResize = src.StorageAutoResize
+	}
+	s.Storage.AutoResizeLimitGB = src.StorageAutoResizeLimit
+
+	if src.AvailabilityType != defaultAvailability {
+		s.AvailabilityType = src.AvailabilityType
+	}
+	// Cloud SQL picks a zone when none is asked for, so the zone is only
+	// kept when a secondary zone pins the pair.
+	if loc := src.LocationPreference; loc != nil && loc.SecondaryZone != "" {
+		s.Zone, s.SecondaryZone = loc.Zone, loc.SecondaryZone
+	}
+
+	if b := src.BackupConfiguration; b != nil && b.Enabled {
+		s.Backup = Backup{Enabled: onlyTrue(true), StartTime: b.StartTime, Location: b.Location}
+		if eng == engine.MySQL {
+			s.Backup.PointInTimeRecovery = onlyTrue(b.BinaryLogEnabled)
+		} else {
+			s.Backup.PointInTimeRecovery = onlyTrue(b.PointInTimeRecoveryEnabled)
+		}
+		if r := b.BackupRetentionSettings; r != nil && r.RetainedBackups != defaultRetainedBackups {
+			s.Backup.RetainedBackups = r.RetainedBackups
+		}
+		if isTrue(s.Backup.PointInTimeRecovery) && b.TransactionLogRetentionDays != defaultLogRetention {
+			s.Backup.TransactionLogRetentionDays = b.TransactionLogRetentionDays
+		}
+	}
+
+	if w := src.MaintenanceWindow; w != nil && w.Day >= 1 && w.Day <= 7 {
+		hour := w.Hour
+		s.Maintenance = Maintenance{Day: days[w.Day-1], Hour: &hour, UpdateTrack: w.UpdateTrack}
+	}
+
+	if ip := src.IpConfiguration; ip != nil {
+		s.Network.PrivateNetwork = ip.PrivateNetwork
+		s.Network.AllocatedIPRange = ip.AllocatedIpRange
+		if !ip.Ipv4Enabled {
+			publicIP := false
+			s.Network.PublicIP = &publicIP
+		}
+		for _, acl := range ip.AuthorizedNetworks {
+			s.Network.AuthorizedNetworks = append(s.Network.AuthorizedNetworks, acl.Value)
+		}
+		if ip.SslMode != defaultSSLMode {
+			s.Network.SSLMode = ip.SslMode
+		}
+	}
+
+	if len(src.DatabaseFlags) > 0 {
+		s.Flags = map[string]string{}
+		for _, f := range src.DatabaseFlags {
+			s.Flags[f.Name] = f.Value
+		}
+	}
+	return s
+}
+
+// envName builds an environment variable name from parts, e.g.
+// ORDERS_DB_APP_PASSWORD.
+func envName(parts ...string) string {
+	name := strings.ToUpper(strings.Join(parts, "_"))
+	return strings.Trim(notEnvChar.ReplaceAllString(name, "_"), "_")
+}
+
+// onlyTrue returns b as an optional bool, left unset when false, the API's
+// default for the switches Export reads.
+func onlyTrue(b bool) *bool {
+	if !b {
+		return nil
+	}
+	return &b
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
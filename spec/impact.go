@@ -0,0 +1,31 @@
+package spec
+
+import "strings"
+
+// disruptive lists the instance fields whose change restarts the instance
+// or takes it offline, per the Cloud SQL documentation. A path matches the
+// field itself and anything below it.
+var disruptive = []struct {
+	path   string
+	reason string
+}{
+	{"databaseVersion", "version upgrades take the instance offline"},
+	{"settings.tier", "tier changes restart the instance"},
+	{"settings.edition", "edition changes restart the instance"},
+	{"settings.availabilityType", "availability changes restart the instance"},
+	{"settings.locationPreference", "zone changes restart the instance"},
+	{"settings.databaseFlags", "many database flags restart the instance"},
+	{"settings.ipConfiguration.privateNetwork", "enabling private IP restarts the instance"},
+	{"settings.dataCacheConfig", "data cache changes restart the instance"},
+}
+
+// downtimeReason returns why changing the field at path causes downtime,
+// or "" if it does not.
+func downtimeReason(path string) string {
+	for _, d := range disruptive {
+		if path == d.path || strings.HasPrefix(path, d.path+".") {
+			return d.reason
+		}
+	}
+	return ""
+}
@@ -0,0 +1,227 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/engine"
+)
+
+// Instance is the desired state of a Cloud SQL instance, as kept in git
+// and applied with `sledge apply`:
+//
+//	name: orders-db
+//	project: my-project
+//	region: us-central1
+//	databaseVersion: POSTGRES_16
+//	settings:
+//	  tier: db-custom-2-7680
+//	  backup:
+//	    enabled: true
+//	databases:
+//	  - name: orders
+//	users:
+//	  - name: app
+//	    passwordEnv: ORDERS_APP_PASSWORD
+//
+// Fields the spec leaves out are left as they are on an existing instance.
+type Instance struct {
+	Name            string `yaml:"name" json:"name"`
+	Project         string `yaml:"project,omitempty" json:"project,omitempty"`
+	Region          string `yaml:"region,omitempty" json:"region,omitempty"`
+	DatabaseVersion string `yaml:"databaseVersion" json:"databaseVersion"`
+	// RootPasswordEnv names the environment variable holding the root
+	// password set when the instance is created. SQL Server requires one.
+	RootPasswordEnv string     `yaml:"rootPasswordEnv,omitempty" json:"rootPasswordEnv,omitempty"`
+	Settings        Settings   `yaml:"settings,omitempty" json:"settings,omitempty"`
+	Databases       []Database `yaml:"databases,omitempty" json:"databases,omitempty"`
+	Users           []User     `yaml:"users,omitempty" json:"users,omitempty"`
+}
+
+// Database is a database that must exist on the instance.
+type Database struct {
+	Name      string `yaml:"name" json:"name"`
+	Charset   string `yaml:"charset,omitempty" json:"charset,omitempty"`
+	Collation string `yaml:"collation,omitempty" json:"collation,omitempty"`
+}
+
+// User is a user that must exist on the instance. Passwords are never
+// stored in the spec, only the environment variable to read them from.
+type User struct {
+	Name string `yaml:"name" json:"name"`
+	// Host restricts where a MySQL user may connect from, e.g. "%".
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+	// Type is BUILT_IN (the default), CLOUD_IAM_USER or
+	// CLOUD_IAM_SERVICE_ACCOUNT.
+	Type        string `yaml:"type,omitempty" json:"type,omitempty"`
+	PasswordEnv string `yaml:"passwordEnv,omitempty" json:"passwordEnv,omitempty"`
+}
+
+var userTypes = map[string]bool{"": true, "BUILT_IN": true, "CLOUD_IAM_USER": true, "CLOUD_IAM_SERVICE_ACCOUNT": true}
+
+// LoadInstance reads an Instance from the YAML file at path. Unknown keys
+// are errors.
+func LoadInstance(path string) (*Instance, error) {
+	i := &Instance{}
+	if err := decodeFile(path, i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Defaults fills in the project and region when the spec leaves them out
+// and expands a bare private network name to a network in the project.
+func (i *Instance) Defaults(project, region string) {
+	if i.Project == "" {
+		i.Project = project
+	}
+	if i.Region == "" {
+		i.Region = region
+	}
+	i.Settings.Network.PrivateNetwork = NetworkPath(i.Project, i.Settings.Network.PrivateNetwork)
+}
+
+// Engine returns the engine of the spec's database version.
+func (i *Instance) Engine() (engine.Engine, error) {
+	return engine.FromVersion(i.DatabaseVersion)
+}
+
+// Validate checks the spec without calling the API, reporting the first
+// problem found.
+func (i *Instance) Validate() error {
+	switch {
+	case i.Name == "":
+		return fmt.Errorf("name is required")
+	case i.Project == "":
+		return fmt.Errorf("%s: project is required", i.Name)
+	case i.Region == "":
+		return fmt.Errorf("%s: region is required", i.Name)
+	case i.DatabaseVersion == "":
+		return fmt.Errorf("%s: databaseVersion is required", i.Name)
+	}
+	eng, err := i.Engine()
+	if err != nil {
+		return fmt.Errorf("%s: %w", i.Name, err)
+	}
+	if err := eng.ValidateVersion(i.DatabaseVersion); err != nil {
+		return fmt.Errorf("%s: %w", i.Name, err)
+	}
+	if i.Settings.Tier != "" {
+		if err := eng.ValidateTier(i.Settings.Tier); err != nil {
+			return fmt.Errorf("%s: %w", i.Name, err)
+		}
+	}
+	if err := i.Settings.Validate(i.Region); err != nil {
+		return fmt.Errorf("%s: %w", i.Name, err)
+	}
+
+	seen := map[string]bool{}
+	for _, db := range i.Databases {
+		if db.Name == "" || seen[db.Name] {
+			return fmt.Errorf("%s: database names must be set and unique, got %q", i.Name, db.Name)
+		}
+		seen[db.Name] = true
+	}
+	seen = map[string]bool{}
+	for _, u := range i.Users {
+		id := u.Name + "@" + u.Host
+		switch {
+		case u.Name == "" || seen[id]:
+			return fmt.Errorf("%s: user names must be set and unique, got %q", i.Name, u.Name)
+		case !userTypes[u.Type]:
+			return fmt.Errorf("%s: user %s: unknown type %q", i.Name, u.Name, u.Type)
+		case u.Host != "" && eng != engine.MySQL:
+			return fmt.Errorf("%s: user %s: host only applies to MySQL", i.Name, u.Name)
+		case (u.Type == "" || u.Type == "BUILT_IN") && u.PasswordEnv == "":
+			return fmt.Errorf("%s: user %s: passwordEnv is required for built-in users", i.Name, u.Name)
+		case u.Type != "" && u.Type != "BUILT_IN" && u.PasswordEnv != "":
+			return fmt.Errorf("%s: user %s: IAM users have no password", i.Name, u.Name)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// NewInstance builds the Instances.Insert request creating the instance,
+// without its root password. Settings the spec leaves out take the engine's
+// or the API's defaults.
+func (i *Instance) NewInstance() (*sqladmin.DatabaseInstance, error) {
+	eng, err := i.Engine()
+	if err != nil {
+		return nil, err
+	}
+	inst := &sqladmin.DatabaseInstance{
+		Name:            i.Name,
+		Project:         i.Project,
+		Region:          i.Region,
+		DatabaseVersion: i.DatabaseVersion,
+		Settings:        &sqladmin.Settings{Tier: eng.DefaultTier()},
+	}
+	i.Settings.ApplyTo(inst.Settings, eng)
+	if err := CheckIPConfiguration(inst.Settings.IpConfiguration); err != nil {
+		return nil, fmt.Errorf("%s: %w", i.Name, err)
+	}
+	if i.RootPasswordEnv == "" && eng == engine.SQLServer {
+		return nil, fmt.Errorf("%s: sqlserver instances need rootPasswordEnv", i.Name)
+	}
+	return inst, nil
+}
+
+// RootPassword reads the root password from the RootPasswordEnv variable.
+// It is "" when the spec sets none.
+func (i *Instance) RootPassword() (string, error) {
+	if i.RootPasswordEnv == "" {
+		return "", nil
+	}
+	password := os.Getenv(i.RootPasswordEnv)
+	if password == "" {
+		return "", fmt.Errorf("%s: environment variable %s (rootPasswordEnv) is not set", i.Name, i.RootPasswordEnv)
+	}
+	return password, nil
+}
+
+// Desired returns current with the spec applied: the instance as it should
+// be. It fails for changes no patch can make, such as moving regions,
+// switching engines or downgrading.
+func (i *Instance) Desired(current *sqladmin.DatabaseInstance) (*sqladmin.DatabaseInstance, error) {
+	if current.Region != "" && current.Region != i.Region {
+		return nil, fmt.Errorf("%s is in region %s, not %s; use `sledge migrate` to move it", i.Name, current.Region, i.Region)
+	}
+	eng, err := i.Engine()
+	if err != nil {
+		return nil, err
+	}
+	if cur, err := engine.FromVersion(current.DatabaseVersion); err == nil && cur != eng {
+		return nil, fmt.Errorf("%s is a %s instance; it cannot become %s", i.Name, cur, eng)
+	} else if err == nil {
+		if err := engine.ValidateUpgrade(current.DatabaseVersion, i.DatabaseVersion); err != nil {
+			return nil, fmt.Errorf("%s: %w", i.Name, err)
+		}
+	}
+
+	desired := CloneInstance(current)
+	if desired.Settings == nil {
+		desired.Settings = &sqladmin.Settings{}
+	}
+	desired.DatabaseVersion = i.DatabaseVersion
+	i.Settings.ApplyTo(desired.Settings, eng)
+	if current.Settings != nil && desired.Settings.DataDiskSizeGb < current.Settings.DataDiskSizeGb {
+		// Disks only grow, e.g. by auto-resize; a smaller size is not a change.
+		desired.Settings.DataDiskSizeGb = current.Settings.DataDiskSizeGb
+	}
+	if err := CheckIPConfiguration(desired.Settings.IpConfiguration); err != nil {
+		return nil, fmt.Errorf("%s: %w", i.Name, err)
+	}
+	return desired, nil
+}
+
+// CloneInstance deep-copies an instance through its JSON representation.
+func CloneInstance(inst *sqladmin.DatabaseInstance) *sqladmin.DatabaseInstance {
+	data, _ := json.Marshal(inst)
+	out := &sqladmin.DatabaseInstance{}
+	json.Unmarshal(data, out)
+	return out
+}
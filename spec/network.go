@@ -0,0 +1,168 @@
+package spec
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/api/sqladmin/v1"
+)
+
+// Network configures how clients reach the instance:
+//
+//	network:
+//	  privateNetwork: default
+//	  publicIp: false
+//	  allocatedIpRange: google-managed-services-default
+//	  sslMode: ENCRYPTED_ONLY
+type Network struct {
+	// PrivateNetwork is the VPC network for a private IP, either a network
+	// name in the instance's project or projects/P/global/networks/N.
+	PrivateNetwork string `yaml:"privateNetwork,omitempty" json:"privateNetwork,omitempty"`
+	// PublicIP defaults to the API's default, enabled.
+	PublicIP *bool `yaml:"publicIp,omitempty" json:"publicIp,omitempty"`
+	// AuthorizedNetworks are the IPv4 CIDR ranges allowed to connect to the
+	// public IP, e.g. 203.0.113.0/24.
+	AuthorizedNetworks []string `yaml:"authorizedNetworks,omitempty" json:"authorizedNetworks,omitempty"`
+	// AllocatedIPRange is the name of the range reserved for private
+	// services access that the private IP is taken from.
+	AllocatedIPRange string `yaml:"allocatedIpRange,omitempty" json:"allocatedIpRange,omitempty"`
+	// SSLMode is ALLOW_UNENCRYPTED_AND_ENCRYPTED, ENCRYPTED_ONLY or
+	// TRUSTED_CLIENT_CERTIFICATE_REQUIRED.
+	SSLMode string `yaml:"sslMode,omitempty" json:"sslMode,omitempty"`
+}
+
+var sslModes = []string{"ALLOW_UNENCRYPTED_AND_ENCRYPTED", "ENCRYPTED_ONLY", "TRUSTED_CLIENT_CERTIFICATE_REQUIRED"}
+
+// Validate checks the SSL mode and that every authorized network is an
+// IPv4 address or CIDR range with no host bits set.
+func (n Network) Validate() error {
+	if n.SSLMode != "" {
+		valid := false
+		for _, mode := range sslModes {
+			valid = valid || strings.EqualFold(n.SSLMode, mode)
+		}
+		if !valid {
+			return fmt.Errorf("SSL mode %q must be one of %s", n.SSLMode, strings.Join(sslModes, ", "))
+		}
+	}
+	for _, cidr := range n.AuthorizedNetworks {
+		if err := checkCIDR(cidr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkCIDR(cidr string) error {
+	if !strings.Contains(cidr, "/") {
+		if ip := net.ParseIP(cidr); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("authorized network %q is not an IPv4 address or CIDR range, e.g. 203.0.113.0/24", cidr)
+		}
+		return nil
+	}
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("authorized network %q is not an IPv4 address or CIDR range, e.g. 203.0.113.0/24", cidr)
+	}
+	if ip.To4() == nil {
+		return fmt.Errorf("authorized network %s: Cloud SQL only authorizes IPv4 ranges", cidr)
+	}
+	if !ip.Equal(ipNet.IP) {
+		return fmt.Errorf("authorized network %s has host bits set (did you mean %s?)", cidr, ipNet)
+	}
+	return nil
+}
+
+// OpenToInternet reports whether an authorized network admits every address.
+func (n Network) OpenToInternet() bool {
+	for _, cidr := range n.AuthorizedNetworks {
+		if strings.HasSuffix(cidr, "/0") {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkPath expands a VPC network name to the full path the API expects,
+// taking the network from project. Full paths are returned unchanged.
+func NetworkPath(project, network string) string {
+	if network == "" || strings.Contains(network, "/") {
+		return network
+	}
+	return fmt.Sprintf("projects/%s/global/networks/%s", project, network)
+}
+
+// ApplyTo copies the network settings that are set into dst, keeping the
+// rest of an existing IP configuration, e.g. one copied from another
+// instance.
+func (n Network) ApplyTo(dst *sqladmin.Settings) {
+	if n.PrivateNetwork == "" && n.PublicIP == nil && n.AuthorizedNetworks == nil &&
+		n.AllocatedIPRange == "" && n.SSLMode == "" {
+		return
+	}
+	ip := dst.IpConfiguration
+	if ip == nil {
+		ip = &sqladmin.IpConfiguration{Ipv4Enabled: true}
+		dst.IpConfiguration = ip
+	}
+	if n.PrivateNetwork != "" {
+		ip.PrivateNetwork = n.PrivateNetwork
+	}
+	if n.PublicIP != nil {
+		ip.Ipv4Enabled = *n.PublicIP
+	}
+	if !ip.Ipv4Enabled {
+		// false is omitted from the request otherwise, leaving the public IP on.
+		ip.ForceSendFields = forceSend(ip.ForceSendFields, "Ipv4Enabled")
+	}
+	if n.AuthorizedNetworks != nil && !sameCIDRs(ip.AuthorizedNetworks, n.AuthorizedNetworks) {
+		ip.AuthorizedNetworks = nil
+		for _, cidr := range n.AuthorizedNetworks {
+			ip.AuthorizedNetworks = append(ip.AuthorizedNetworks, &sqladmin.AclEntry{Value: cidr})
+		}
+	}
+	if n.AllocatedIPRange != "" {
+		ip.AllocatedIpRange = n.AllocatedIPRange
+	}
+	if n.SSLMode != "" {
+		ip.SslMode = strings.ToUpper(n.SSLMode)
+		// requireSsl is the legacy form of sslMode; the API rejects
+		// combinations that disagree.
+		ip.RequireSsl = ip.SslMode == "TRUSTED_CLIENT_CERTIFICATE_REQUIRED"
+	}
+}
+
+// CheckIPConfiguration reports combinations of IP settings the API would
+// reject, e.g. an instance with neither a public nor a private IP.
+func CheckIPConfiguration(ip *sqladmin.IpConfiguration) error {
+	if ip == nil {
+		return nil
+	}
+	switch {
+	case !ip.Ipv4Enabled && ip.PrivateNetwork == "":
+		return fmt.Errorf("an instance without a public IP needs a private network")
+	case !ip.Ipv4Enabled && len(ip.AuthorizedNetworks) > 0:
+		return fmt.Errorf("authorized networks need a public IP")
+	case ip.AllocatedIpRange != "" && ip.PrivateNetwork == "":
+		return fmt.Errorf("an allocated IP range needs a private network")
+	}
+	return nil
+}
+
+// sameCIDRs reports whether the ACL entries allow exactly cidrs, in any order.
+func sameCIDRs(entries []*sqladmin.AclEntry, cidrs []string) bool {
+	if len(entries) != len(cidrs) {
+		return false
+	}
+	want := map[string]bool{}
+	for _, cidr := range cidrs {
+		want[cidr] = true
+	}
+	for _, e := range entries {
+		if !want[e.Value] {
+			return false
+		}
+	}
+	return true
+}
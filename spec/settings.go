@@ -0,0 +1,393 @@
+// Package spec describes Cloud SQL instances in a form sledge users write
+// by hand: YAML files and flags that translate into sqladmin requests.
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/sqladmin/v1"
+	"gopkg.in/yaml.v3"
+
+	"github.com/code4bread/sledge/engine"
+)
+
+// Settings are the instance settings create applies on top of the tier,
+// e.g. loaded from a --settingsFile:
+//
+//	storage:
+//	  sizeGb: 100
+//	  type: SSD
+//	  autoResizeLimitGb: 500
+//	availabilityType: REGIONAL
+//	zone: us-central1-a
+//	secondaryZone: us-central1-c
+//	backup:
+//	  enabled: true
+//	  startTime: "03:00"
+//	  pointInTimeRecovery: true
+//	maintenance:
+//	  day: SUN
+//	  hour: 4
+//	network:
+//	  privateNetwork: default
+//	  publicIp: false
+//	flags:
+//	  max_connections: 500
+//	labels:
+//	  team: payments
+//	deletionProtection: true
+type Settings struct {
+	Tier               string            `yaml:"tier,omitempty" json:"tier,omitempty"`
+	Storage            Storage           `yaml:"storage,omitempty" json:"storage,omitempty"`
+	AvailabilityType   string            `yaml:"availabilityType,omitempty" json:"availabilityType,omitempty"`
+	Zone               string            `yaml:"zone,omitempty" json:"zone,omitempty"`
+	SecondaryZone      string            `yaml:"secondaryZone,omitempty" json:"secondaryZone,omitempty"`
+	Backup             Backup            `yaml:"backup,omitempty" json:"backup,omitempty"`
+	Maintenance        Maintenance       `yaml:"maintenance,omitempty" json:"maintenance,omitempty"`
+	Network            Network           `yaml:"network,omitempty" json:"network,omitempty"`
+	Flags              map[string]string `yaml:"flags,omitempty" json:"flags,omitempty"`
+	Labels             map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	DeletionProtection *bool             `yaml:"deletionProtection,omitempty" json:"deletionProtection,omitempty"`
+}
+
+// Storage configures the data disk.
+type Storage struct {
+	SizeGB int64 `yaml:"sizeGb,omitempty" json:"sizeGb,omitempty"`
+	// Type is SSD or HDD.
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// AutoResize defaults to the API's default, enabled.
+	AutoResize        *bool `yaml:"autoResize,omitempty" json:"autoResize,omitempty"`
+	AutoResizeLimitGB int64 `yaml:"autoResizeLimitGb,omitempty" json:"autoResizeLimitGb,omitempty"`
+}
+
+// Backup configures automated backups. Enabled and PointInTimeRecovery are
+// pointers so that an explicit false turns them off rather than leaving
+// them as they are.
+type Backup struct {
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// StartTime is the UTC start of the backup window, HH:MM.
+	StartTime string `yaml:"startTime,omitempty" json:"startTime,omitempty"`
+	// PointInTimeRecovery turns on binary logs for MySQL and point-in-time
+	// recovery for PostgreSQL and SQL Server.
+	PointInTimeRecovery         *bool  `yaml:"pointInTimeRecovery,omitempty" json:"pointInTimeRecovery,omitempty"`
+	RetainedBackups             int64  `yaml:"retainedBackups,omitempty" json:"retainedBackups,omitempty"`
+	TransactionLogRetentionDays int64  `yaml:"transactionLogRetentionDays,omitempty" json:"transactionLogRetentionDays,omitempty"`
+	Location                    string `yaml:"location,omitempty" json:"location,omitempty"`
+}
+
+// Maintenance configures the weekly maintenance window.
+type Maintenance struct {
+	// Day is MON to SUN, or 1 (Monday) to 7.
+	Day string `yaml:"day,omitempty" json:"day,omitempty"`
+	// Hour is the UTC hour the window starts, 0 to 23.
+	Hour *int64 `yaml:"hour,omitempty" json:"hour,omitempty"`
+	// UpdateTrack is canary, stable or week5.
+	UpdateTrack string `yaml:"updateTrack,omitempty" json:"updateTrack,omitempty"`
+}
+
+// LoadSettings reads Settings from the YAML file at path. Unknown keys are
+// errors so typos do not silently fall back to the API's defaults.
+func LoadSettings(path string) (*Settings, error) {
+	s := &Settings{}
+	if err := decodeFile(path, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// decodeFile decodes the YAML file at path into v, rejecting unknown keys.
+// An empty file leaves v unchanged.
+func decodeFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+var (
+	days        = []string{"MON", "TUE", "WED", "THU", "FRI", "SAT", "SUN"}
+	startTime   = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+	labelKey    = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	labelValue  = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+	flagName    = regexp.MustCompile(`^[a-z][a-z0-9_.]*$`)
+	diskTypes   = map[string]string{"SSD": "PD_SSD", "HDD": "PD_HDD", "PD_SSD": "PD_SSD", "PD_HDD": "PD_HDD"}
+	updateTrack = map[string]bool{"canary": true, "stable": true, "week5": true}
+)
+
+// minDiskSizeGB is the smallest data disk Cloud SQL creates.
+const minDiskSizeGB = 10
+
+// Validate checks the settings for an instance in region, reporting the
+// first problem found.
+func (s *Settings) Validate(region string) error {
+	st := s.Storage
+	if st.Type != "" && diskTypes[strings.ToUpper(st.Type)] == "" {
+		return fmt.Errorf("storage type %q must be SSD or HDD", st.Type)
+	}
+	if st.SizeGB != 0 && st.SizeGB < minDiskSizeGB {
+		return fmt.Errorf("storage size must be at least %d GB, not %d", minDiskSizeGB, st.SizeGB)
+	}
+	if st.AutoResizeLimitGB != 0 {
+		if st.AutoResize != nil && !*st.AutoResize {
+			return fmt.Errorf("storage auto-resize limit is set but auto-resize is disabled")
+		}
+		if st.AutoResizeLimitGB < st.SizeGB {
+			return fmt.Errorf("storage auto-resize limit %d GB is below the size %d GB", st.AutoResizeLimitGB, st.SizeGB)
+		}
+	}
+
+	switch strings.ToUpper(s.AvailabilityType) {
+	case "", "ZONAL", "REGIONAL":
+	default:
+		return fmt.Errorf("availability type %q must be ZONAL or REGIONAL", s.AvailabilityType)
+	}
+	for _, zone := range []string{s.Zone, s.SecondaryZone} {
+		if zone != "" && region != "" && !strings.HasPrefix(zone, region+"-") {
+			return fmt.Errorf("zone %s is not in region %s", zone, region)
+		}
+	}
+	if s.SecondaryZone != "" {
+		switch {
+		case !strings.EqualFold(s.AvailabilityType, "REGIONAL"):
+			return fmt.Errorf("a secondary zone needs availability type REGIONAL")
+		case s.Zone == "":
+			return fmt.Errorf("a secondary zone needs a zone")
+		case s.SecondaryZone == s.Zone:
+			return fmt.Errorf("the secondary zone must differ from the zone %s", s.Zone)
+		}
+	}
+
+	b := s.Backup
+	if !isTrue(b.Enabled) && (isTrue(b.PointInTimeRecovery) || b.StartTime != "" || b.RetainedBackups != 0 ||
+		b.TransactionLogRetentionDays != 0 || b.Location != "") {
+		return fmt.Errorf("backup settings are given but backups are not enabled")
+	}
+	if b.StartTime != "" && !startTime.MatchString(b.StartTime) {
+		return fmt.Errorf("backup start time %q must be HH:MM in UTC", b.StartTime)
+	}
+	if b.RetainedBackups != 0 && (b.RetainedBackups < 1 || b.RetainedBackups > 365) {
+		return fmt.Errorf("retained backups must be between 1 and 365, not %d", b.RetainedBackups)
+	}
+	if b.TransactionLogRetentionDays != 0 {
+		if !isTrue(b.PointInTimeRecovery) {
+			return fmt.Errorf("transaction log retention needs point-in-time recovery")
+		}
+		if b.TransactionLogRetentionDays < 1 || b.TransactionLogRetentionDays > 35 {
+			return fmt.Errorf("transaction log retention must be between 1 and 35 days, not %d", b.TransactionLogRetentionDays)
+		}
+	}
+
+	m := s.Maintenance
+	if m.Day != "" {
+		if _, err := maintenanceDay(m.Day); err != nil {
+			return err
+		}
+	}
+	if m.Hour != nil && (*m.Hour < 0 || *m.Hour > 23) {
+		return fmt.Errorf("maintenance hour must be between 0 and 23, not %d", *m.Hour)
+	}
+	if m.Hour != nil && m.Day == "" {
+		return fmt.Errorf("a maintenance hour needs a maintenance day")
+	}
+	if m.UpdateTrack != "" && !updateTrack[strings.ToLower(m.UpdateTrack)] {
+		return fmt.Errorf("maintenance update track %q must be canary, stable or week5", m.UpdateTrack)
+	}
+
+	if err := s.Network.Validate(); err != nil {
+		return err
+	}
+
+	for name := range s.Flags {
+		if !flagName.MatchString(name) {
+			return fmt.Errorf("invalid database flag name %q", name)
+		}
+	}
+	for k, v := range s.Labels {
+		if !labelKey.MatchString(k) {
+			return fmt.Errorf("invalid label key %q: use lowercase letters, digits, _ and -, starting with a letter", k)
+		}
+		if !labelValue.MatchString(v) {
+			return fmt.Errorf("invalid value %q for label %s: use at most 63 lowercase letters, digits, _ and -", v, k)
+		}
+	}
+	return nil
+}
+
+// maintenanceDay converts MON..SUN or 1..7 to the API's day number.
+func maintenanceDay(day string) (int64, error) {
+	for i, d := range days {
+		if strings.EqualFold(day, d) {
+			return int64(i + 1), nil
+		}
+	}
+	if n, err := strconv.ParseInt(day, 10, 64); err == nil && n >= 1 && n <= 7 {
+		return n, nil
+	}
+	return 0, fmt.Errorf("maintenance day %q must be MON to SUN or 1 to 7", day)
+}
+
+// ApplyTo copies the settings that are set into dst, the settings of an
+// instance of engine eng, merging into dst's existing structures so fields
+// the spec leaves out keep their values. Call Validate first.
+func (s *Settings) ApplyTo(dst *sqladmin.Settings, eng engine.Engine) {
+	if s.Tier != "" {
+		dst.Tier = s.Tier
+	}
+
+	if s.Storage.SizeGB != 0 {
+		dst.DataDiskSizeGb = s.Storage.SizeGB
+	}
+	if s.Storage.Type != "" {
+		dst.DataDiskType = diskTypes[strings.ToUpper(s.Storage.Type)]
+	}
+	if s.Storage.AutoResize != nil {
+		dst.StorageAutoResize = s.Storage.AutoResize
+	}
+	if s.Storage.AutoResizeLimitGB != 0 {
+		dst.StorageAutoResizeLimit = s.Storage.AutoResizeLimitGB
+	}
+
+	if s.AvailabilityType != "" {
+		dst.AvailabilityType = strings.ToUpper(s.AvailabilityType)
+	}
+	if s.Zone != "" || s.SecondaryZone != "" {
+		if dst.LocationPreference == nil {
+			dst.LocationPreference = &sqladmin.LocationPreference{}
+		}
+		setString(&dst.LocationPreference.Zone, s.Zone)
+		setString(&dst.LocationPreference.SecondaryZone, s.SecondaryZone)
+	}
+
+	if b := s.Backup; b.Enabled != nil {
+		if dst.BackupConfiguration == nil {
+			dst.BackupConfiguration = &sqladmin.BackupConfiguration{}
+		}
+		cfg := dst.BackupConfiguration
+		cfg.Enabled = *b.Enabled
+		if !cfg.Enabled {
+			// Point-in-time recovery needs backups, so it goes off with them.
+			disabled := false
+			b.PointInTimeRecovery = &disabled
+			cfg.ForceSendFields = forceSend(cfg.ForceSendFields, "Enabled")
+		}
+		setString(&cfg.StartTime, b.StartTime)
+		setString(&cfg.Location, b.Location)
+		if b.TransactionLogRetentionDays != 0 {
+			cfg.TransactionLogRetentionDays = b.TransactionLogRetentionDays
+		}
+		if pitr := b.PointInTimeRecovery; pitr != nil {
+			if eng == engine.MySQL {
+				cfg.BinaryLogEnabled = *pitr
+				cfg.ForceSendFields = forceSend(cfg.ForceSendFields, "BinaryLogEnabled")
+			} else {
+				cfg.PointInTimeRecoveryEnabled = *pitr
+				cfg.ForceSendFields = forceSend(cfg.ForceSendFields, "PointInTimeRecoveryEnabled")
+			}
+		}
+		if b.RetainedBackups != 0 {
+			if cfg.BackupRetentionSettings == nil {
+				cfg.BackupRetentionSettings = &sqladmin.BackupRetentionSettings{}
+			}
+			cfg.BackupRetentionSettings.RetainedBackups = b.RetainedBackups
+			cfg.BackupRetentionSettings.RetentionUnit = "COUNT"
+		}
+	}
+
+	if m := s.Maintenance; m.Day != "" {
+		if dst.MaintenanceWindow == nil {
+			dst.MaintenanceWindow = &sqladmin.MaintenanceWindow{}
+		}
+		window := dst.MaintenanceWindow
+		window.Day, _ = maintenanceDay(m.Day)
+		setString(&window.UpdateTrack, strings.ToLower(m.UpdateTrack))
+		if m.Hour != nil {
+			window.Hour = *m.Hour
+			// Hour 0 (midnight) is a real value, not "unset".
+			window.ForceSendFields = forceSend(window.ForceSendFields, "Hour")
+		}
+	}
+
+	s.Network.ApplyTo(dst)
+
+	// Flags and labels the spec does not list are kept, like every other
+	// field it leaves out.
+	dst.DatabaseFlags = mergeFlags(dst.DatabaseFlags, s.Flags)
+	if len(s.Labels) > 0 {
+		labels := make(map[string]string, len(dst.UserLabels)+len(s.Labels))
+		for k, v := range dst.UserLabels {
+			labels[k] = v
+		}
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		dst.UserLabels = labels
+	}
+	if s.DeletionProtection != nil {
+		dst.DeletionProtectionEnabled = *s.DeletionProtection
+		dst.ForceSendFields = forceSend(dst.ForceSendFields, "DeletionProtectionEnabled")
+	}
+}
+
+// mergeFlags sets flags over the current database flags: existing flags
+// keep their place with the new value, new ones follow sorted by name.
+func mergeFlags(current []*sqladmin.DatabaseFlags, flags map[string]string) []*sqladmin.DatabaseFlags {
+	if len(flags) == 0 {
+		return current
+	}
+	merged := make([]*sqladmin.DatabaseFlags, 0, len(current)+len(flags))
+	seen := map[string]bool{}
+	for _, f := range current {
+		if v, ok := flags[f.Name]; ok {
+			f = &sqladmin.DatabaseFlags{Name: f.Name, Value: v}
+			seen[f.Name] = true
+		}
+		merged = append(merged, f)
+	}
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		merged = append(merged, &sqladmin.DatabaseFlags{Name: name, Value: flags[name]})
+	}
+	return merged
+}
+
+// setString sets *dst to v unless v is empty.
+func setString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// isTrue reports whether an optional bool is set and true.
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+// forceSend adds field to a ForceSendFields list unless it is already there.
+func forceSend(fields []string, field string) []string {
+	for _, f := range fields {
+		if f == field {
+			return fields
+		}
+	}
+	return append(fields, field)
+}
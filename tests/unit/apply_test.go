@@ -0,0 +1,246 @@
+package unit_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/cmd"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/spec"
+)
+
+const ordersSpec = `
+name: orders-db
+project: p
+region: us-central1
+databaseVersion: POSTGRES_16
+settings:
+  tier: db-custom-2-7680
+  backup:
+    enabled: true
+    startTime: "03:00"
+  flags:
+    max_connections: 200
+databases:
+  - name: orders
+users:
+  - name: app
+    passwordEnv: SLEDGE_TEST_APP_PASSWORD
+`
+
+func TestApplyCreatesThenPatchesOnlyChanges(t *testing.T) {
+	t.Setenv("SLEDGE_TEST_APP_PASSWORD", "s3cret")
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+	setForTest(t, "apply.pollInterval", time.Millisecond)
+	setForTest(t, "apply.timeout", time.Minute)
+
+	path := writeTemp(t, ordersSpec)
+	setForTest(t, "apply.filename", []string{path})
+	require.NoError(t, cmd.ApplyCmd.RunE(cmd.ApplyCmd, nil))
+
+	ctx := context.Background()
+	inst, err := c.GetInstance(ctx, "p", "orders-db")
+	require.NoError(t, err)
+	assert.Equal(t, "db-custom-2-7680", inst.Settings.Tier)
+	dbs, err := c.ListDatabases(ctx, "p", "orders-db")
+	require.NoError(t, err)
+	require.Len(t, dbs, 1)
+	users, err := c.ListUsers(ctx, "p", "orders-db")
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+
+	// Applying the same spec again changes nothing.
+	desired, err := loadTestSpec(t, path).Desired(inst)
+	require.NoError(t, err)
+	assert.Empty(t, spec.Diff(inst, desired))
+
+	// Flags and labels added outside the spec are kept, not removed.
+	extra := spec.CloneInstance(inst).Settings
+	extra.DatabaseFlags = append(extra.DatabaseFlags, &sqladmin.DatabaseFlags{Name: "log_min_duration_statement", Value: "1000"})
+	extra.UserLabels = map[string]string{"owner": "dba"}
+	op, err := c.PatchInstance(ctx, "p", "orders-db", &sqladmin.DatabaseInstance{Settings: extra})
+	require.NoError(t, err)
+	_, err = c.GetOperation(ctx, "p", op.Name)
+	require.NoError(t, err)
+	inst, err = c.GetInstance(ctx, "p", "orders-db")
+	require.NoError(t, err)
+	desired, err = loadTestSpec(t, path).Desired(inst)
+	require.NoError(t, err)
+	assert.Empty(t, spec.Diff(inst, desired))
+
+	updated := strings.Replace(ordersSpec, "max_connections: 200", "max_connections: 400", 1)
+	require.NoError(t, os.WriteFile(path, []byte(updated), 0o644))
+	desired, err = loadTestSpec(t, path).Desired(inst)
+	require.NoError(t, err)
+	changes := spec.Diff(inst, desired)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "settings.databaseFlags", changes[0].Path)
+	patch := spec.Patch(desired, changes)
+	assert.Empty(t, patch.Settings.Tier, "unchanged fields are not sent")
+	assert.Nil(t, patch.Settings.BackupConfiguration)
+
+	require.NoError(t, cmd.ApplyCmd.RunE(cmd.ApplyCmd, nil))
+	inst, err = c.GetInstance(ctx, "p", "orders-db")
+	require.NoError(t, err)
+	assert.Equal(t, "400", inst.Settings.DatabaseFlags[0].Value)
+	assert.Len(t, inst.Settings.DatabaseFlags, 2)
+	assert.Equal(t, "dba", inst.Settings.UserLabels["owner"])
+	assert.Equal(t, "03:00", inst.Settings.BackupConfiguration.StartTime)
+
+	// An explicit false turns backups off instead of being dropped.
+	off := strings.Replace(ordersSpec, "    enabled: true\n    startTime: \"03:00\"\n", "    enabled: false\n", 1)
+	require.NoError(t, os.WriteFile(path, []byte(off), 0o644))
+	require.NoError(t, cmd.ApplyCmd.RunE(cmd.ApplyCmd, nil))
+	inst, err = c.GetInstance(ctx, "p", "orders-db")
+	require.NoError(t, err)
+	assert.False(t, inst.Settings.BackupConfiguration.Enabled)
+
+	moved := strings.Replace(ordersSpec, "region: us-central1", "region: europe-west1", 1)
+	require.NoError(t, os.WriteFile(path, []byte(moved), 0o644))
+	err = cmd.ApplyCmd.RunE(cmd.ApplyCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.Validation), "region change: %v", err)
+}
+
+func loadTestSpec(t *testing.T, path string) *spec.Instance {
+	t.Helper()
+	s, err := spec.LoadInstance(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Validate())
+	return s
+}
+
+func TestPlanReportsPendingChangesWithoutMakingThem(t *testing.T) {
+	t.Setenv("SLEDGE_TEST_APP_PASSWORD", "s3cret")
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+	setForTest(t, "apply.pollInterval", time.Millisecond)
+	setForTest(t, "apply.timeout", time.Minute)
+
+	path := writeTemp(t, ordersSpec)
+	setForTest(t, "plan.filename", []string{path})
+	err := cmd.PlanCmd.RunE(cmd.PlanCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.ChangesPending), "missing instance: %v", err)
+	assert.Equal(t, 10, cmd.ExitCode(err))
+
+	setForTest(t, "apply.filename", []string{path})
+	require.NoError(t, cmd.ApplyCmd.RunE(cmd.ApplyCmd, nil))
+	assert.NoError(t, cmd.PlanCmd.RunE(cmd.PlanCmd, nil), "nothing pending after apply")
+
+	resized := strings.Replace(ordersSpec, "db-custom-2-7680", "db-custom-4-15360", 1)
+	require.NoError(t, os.WriteFile(path, []byte(resized), 0o644))
+	err = cmd.PlanCmd.RunE(cmd.PlanCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.ChangesPending), "tier change: %v", err)
+	inst, err := c.GetInstance(context.Background(), "p", "orders-db")
+	require.NoError(t, err)
+	assert.Equal(t, "db-custom-2-7680", inst.Settings.Tier, "plan changes nothing")
+
+	desired, err := loadTestSpec(t, path).Desired(inst)
+	require.NoError(t, err)
+	changes := spec.Diff(inst, desired)
+	require.Len(t, changes, 1)
+	assert.True(t, changes[0].Downtime, "tier changes restart the instance")
+	assert.True(t, spec.HasDowntime(changes))
+}
+
+func TestDriftReportsConsoleChanges(t *testing.T) {
+	t.Setenv("SLEDGE_TEST_APP_PASSWORD", "s3cret")
+	ctx := context.Background()
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+	setForTest(t, "apply.pollInterval", time.Millisecond)
+	setForTest(t, "apply.timeout", time.Minute)
+
+	labeled := strings.Replace(ordersSpec, "  flags:", "  labels:\n    team: orders\n  flags:", 1)
+	path := writeTemp(t, labeled)
+	setForTest(t, "apply.filename", []string{path})
+	require.NoError(t, cmd.ApplyCmd.RunE(cmd.ApplyCmd, nil))
+	setForTest(t, "drift.filename", []string{path})
+	assert.NoError(t, cmd.DriftCmd.RunE(cmd.DriftCmd, nil), "in sync after apply")
+
+	// Someone resizes the instance in the console.
+	op, err := c.PatchInstance(ctx, "p", "orders-db", &sqladmin.DatabaseInstance{
+		Settings: &sqladmin.Settings{Tier: "db-custom-4-15360"},
+	})
+	require.NoError(t, err)
+	_, err = c.GetOperation(ctx, "p", op.Name)
+	require.NoError(t, err)
+
+	err = cmd.DriftCmd.RunE(cmd.DriftCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.ChangesPending), "tier drift: %v", err)
+
+	// Scanning by label checks unnamed instances against the create defaults.
+	setForTest(t, "drift.filename", "")
+	setForTest(t, "drift.project", []string{"p"})
+	setForTest(t, "drift.label", []string{"team=orders"})
+	setForTest(t, "create.databaseFlags", []string{"max_connections=200"})
+	assert.NoError(t, cmd.DriftCmd.RunE(cmd.DriftCmd, nil), "matches the create defaults")
+	setForTest(t, "create.databaseFlags", []string{"max_connections=500"})
+	err = cmd.DriftCmd.RunE(cmd.DriftCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.ChangesPending), "flag drift from defaults: %v", err)
+
+	// A spec whose instance lost the scanned label is missing from the scan.
+	setForTest(t, "drift.filename", []string{path})
+	setForTest(t, "drift.label", []string{"team=billing"})
+	setForTest(t, "output", "json")
+	out, err := captureStdout(t, func() error { return cmd.DriftCmd.RunE(cmd.DriftCmd, nil) })
+	assert.True(t, errkind.Is(err, errkind.ChangesPending), "spec instance not scanned: %v", err)
+	assert.Contains(t, out, `"instance": "orders-db"`)
+	assert.Contains(t, out, `"status": "missing"`)
+}
+
+func TestExportSpecRoundTrips(t *testing.T) {
+	t.Setenv("SLEDGE_TEST_APP_PASSWORD", "s3cret")
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+	setForTest(t, "apply.pollInterval", time.Millisecond)
+	setForTest(t, "apply.timeout", time.Minute)
+	setForTest(t, "apply.filename", []string{writeTemp(t, ordersSpec)})
+	require.NoError(t, cmd.ApplyCmd.RunE(cmd.ApplyCmd, nil))
+
+	setForTest(t, "exportSpec.project", "p")
+	setForTest(t, "exportSpec.instance", "orders-db")
+	out, err := captureStdout(t, func() error { return cmd.ExportSpecCmd.RunE(cmd.ExportSpecCmd, nil) })
+	require.NoError(t, err)
+	assert.NotContains(t, out, "etag")
+	assert.NotContains(t, out, "settingsVersion")
+	assert.NotContains(t, out, "storage: {}")
+	assert.Contains(t, out, "passwordEnv: ORDERS_DB_APP_PASSWORD")
+
+	exported := loadTestSpec(t, writeTemp(t, out))
+	assert.Equal(t, "db-custom-2-7680", exported.Settings.Tier)
+	assert.Equal(t, map[string]string{"max_connections": "200"}, exported.Settings.Flags)
+	assert.Equal(t, []spec.Database{{Name: "orders"}}, exported.Databases)
+
+	inst, err := c.GetInstance(context.Background(), "p", "orders-db")
+	require.NoError(t, err)
+	desired, err := exported.Desired(inst)
+	require.NoError(t, err)
+	assert.Empty(t, spec.Diff(inst, desired), "applying the export changes nothing")
+
+	// JSON is as minimal as YAML; table formats are rejected up front.
+	setForTest(t, "output", "json")
+	out, err = captureStdout(t, func() error { return cmd.ExportSpecCmd.RunE(cmd.ExportSpecCmd, nil) })
+	require.NoError(t, err)
+	assert.Contains(t, out, `"max_connections": "200"`)
+	assert.NotContains(t, out, `"storage"`)
+	var fromJSON spec.Instance
+	require.NoError(t, json.Unmarshal([]byte(out), &fromJSON))
+	assert.Equal(t, exported, &fromJSON)
+
+	setForTest(t, "output", "table")
+	_, err = captureStdout(t, func() error { return cmd.ExportSpecCmd.RunE(cmd.ExportSpecCmd, nil) })
+	assert.True(t, errkind.Is(err, errkind.Validation), "-o table: %v", err)
+}
@@ -0,0 +1,74 @@
+package unit_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+)
+
+func TestClientAgainstHTTPTestServer(t *testing.T) {
+	var gotUserAgent string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/projects/demo/instances/db1", func(w http.ResponseWriter, r *http.Request) {
+		gotUserAgent = r.Header.Get("User-Agent")
+		json.NewEncoder(w).Encode(&sqladmin.DatabaseInstance{
+			Name:            "db1",
+			Project:         "demo",
+			DatabaseVersion: "MYSQL_8_0",
+		})
+	})
+	mux.HandleFunc("/v1/projects/demo/instances/db1/backupRuns", func(w http.ResponseWriter, r *http.Request) {
+		resp := &sqladmin.BackupRunsListResponse{Items: []*sqladmin.BackupRun{{Id: 1}}}
+		if r.URL.Query().Get("pageToken") == "" {
+			resp.NextPageToken = "next"
+		} else {
+			resp.Items = []*sqladmin.BackupRun{{Id: 2}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c, err := client.New(ctx, client.WithEndpoint(srv.URL+"/"), client.WithUserAgent("sledge-test"))
+	require.NoError(t, err)
+
+	inst, err := c.GetInstance(ctx, "demo", "db1")
+	require.NoError(t, err)
+	assert.Equal(t, "MYSQL_8_0", inst.DatabaseVersion)
+	assert.Contains(t, gotUserAgent, "sledge-test")
+
+	runs, err := c.ListBackupRuns(ctx, "demo", "db1")
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, int64(2), runs[1].Id)
+}
+
+func TestClientRequestLogging(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	var logged []client.Request
+	ctx := context.Background()
+	c, err := client.New(ctx, client.WithEndpoint(srv.URL+"/"),
+		client.WithRequestLogging(func(r client.Request) { logged = append(logged, r) }))
+	require.NoError(t, err)
+
+	_, err = c.GetInstance(ctx, "demo", "missing")
+	require.Error(t, err)
+	require.Len(t, logged, 1)
+	assert.Equal(t, http.MethodGet, logged[0].Method)
+	assert.Contains(t, logged[0].URL, "/v1/projects/demo/instances/missing")
+	assert.Equal(t, http.StatusNotFound, logged[0].Status)
+	assert.NoError(t, logged[0].Err)
+}
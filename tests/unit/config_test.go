@@ -0,0 +1,160 @@
+package unit_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/code4bread/sledge/cmd"
+	"github.com/code4bread/sledge/config"
+)
+
+// setForTest overrides a viper key for the duration of the test. Cleanup
+// restores the previous value; a key that was not set gets a nil override,
+// which viper skips, so config, environment and flag defaults show again.
+func setForTest(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	var previous interface{}
+	if viper.IsSet(key) {
+		previous = viper.Get(key)
+	}
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, previous) })
+}
+
+func TestCreateFallsBackToGlobalProjectAndRegion(t *testing.T) {
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+
+	setForTest(t, config.KeyProjectID, "global-project")
+	setForTest(t, config.KeyDefaultRegion, "europe-west4")
+	setForTest(t, "create.instance", "db-global")
+
+	require.NoError(t, cmd.CreateCmd.RunE(cmd.CreateCmd, nil))
+
+	inst, err := c.GetInstance(context.Background(), "global-project", "db-global")
+	require.NoError(t, err)
+	assert.Equal(t, "europe-west4", inst.Region)
+}
+
+func TestLoadAppConfig(t *testing.T) {
+	setForTest(t, config.KeyProjectID, "p1")
+	setForTest(t, config.KeyCredentials, "/tmp/creds.json")
+	setForTest(t, config.KeyDefaultRegion, "asia-east1")
+
+	assert.Equal(t, config.AppConfig{
+		ProjectID:     "p1",
+		Credentials:   "/tmp/creds.json",
+		DefaultRegion: "asia-east1",
+	}, config.LoadAppConfig())
+}
+
+func TestSetFileValuePreservesCommentsAndMatchesCase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sledge.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`# shared settings
+current_profile: dev
+profiles:
+  dev:
+    project_id: dev-project # the sandbox
+create:
+  dbVersion: MYSQL_8_0
+`), 0o600))
+
+	require.NoError(t, config.SetFileValue(path, "current_profile", "prod"))
+	require.NoError(t, config.SetFileValue(path, "profiles.prod.project_id", "prod-project"))
+	require.NoError(t, config.SetFileValue(path, "create.dbversion", "MYSQL_8_4"))
+	assert.Error(t, config.SetFileValue(path, "profiles", "x"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `# shared settings
+current_profile: prod
+profiles:
+  dev:
+    project_id: dev-project # the sandbox
+  prod:
+    project_id: prod-project
+create:
+  dbVersion: MYSQL_8_4
+`, string(data))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestValidateFileReportsTyposAndBadValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sledge.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`project_id: p
+current_profile: dev
+create:
+  dbversion: MYSQL_8_0
+  instanse: db
+migrate:
+  pollInterval: 5 seconds
+profiles:
+  dev:
+    cleanupOnInterrupt: maybe
+`), 0o600))
+	settings := []config.Setting{
+		{Key: config.KeyProjectID, Type: "string"},
+		{Key: "cleanupOnInterrupt", Type: "bool"},
+		{Key: "create.dbVersion", Type: "string"},
+		{Key: "create.instance", Type: "string"},
+		{Key: "migrate.pollInterval", Type: "duration"},
+	}
+
+	problems, err := config.ValidateFile(path, settings)
+	require.NoError(t, err)
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, fmt.Sprintf("%d: %s", p.Line, p))
+	}
+	assert.Equal(t, []string{
+		"4: warning: create.dbversion: should be spelled create.dbVersion",
+		"5: error: create.instanse: unknown key (did you mean create.instance?)",
+		`7: error: migrate.pollInterval: "5 seconds" is not a valid duration`,
+		`10: error: profiles.dev.cleanupOnInterrupt: "maybe" is not a valid bool`,
+	}, got)
+}
+
+func TestEnvironmentVariablesUseSledgePrefix(t *testing.T) {
+	config.SetupEnv()
+	t.Setenv("SLEDGE_MIGRATE_TARGETREGION", "europe-west1")
+	t.Setenv("SLEDGE_OPERATIONS_STATUS", "PENDING,RUNNING")
+
+	assert.Equal(t, "SLEDGE_MIGRATE_TARGETREGION", config.EnvVar("migrate.targetRegion"))
+	assert.Equal(t, "europe-west1", viper.GetString("migrate.targetRegion"))
+	assert.Equal(t, "PENDING,RUNNING", viper.GetString("operations.status"))
+}
+
+func TestConfigViewReportsProfileFlag(t *testing.T) {
+	profile := cmd.ConfigCmd.Root().PersistentFlags().Lookup("profile")
+	require.NotNil(t, profile)
+	require.NoError(t, profile.Value.Set("prod"))
+	profile.Changed = true
+	t.Cleanup(func() {
+		profile.Value.Set("")
+		profile.Changed = false
+	})
+
+	var view *cobra.Command
+	for _, c := range cmd.ConfigCmd.Commands() {
+		if c.Name() == "view" {
+			view = c
+		}
+	}
+	require.NotNil(t, view)
+	out, err := captureStdout(t, func() error { return view.RunE(view, []string{"profile"}) })
+	require.NoError(t, err)
+	assert.Regexp(t, `profile\s+prod\s+flag --profile`, out)
+}
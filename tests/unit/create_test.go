@@ -17,7 +17,7 @@ func TestInit(t *testing.T) {
 	assert.Equal(t, "", viper.GetString("create.instance"))
 	assert.Equal(t, "db-f1-micro", viper.GetString("create.tier"))
 	assert.Equal(t, "us-central1", viper.GetString("create.region"))
-	assert.Equal(t, "MYSQL_8_0", viper.GetString("create.dbVersion"))
+	assert.Equal(t, "", viper.GetString("create.dbVersion"))
 
 	// Check if the flags are correctly set in the command
 	projectFlag := createCmd.Flags().Lookup("project")
@@ -30,7 +30,7 @@ func TestInit(t *testing.T) {
 
 	tierFlag := createCmd.Flags().Lookup("tier")
 	assert.NotNil(t, tierFlag)
-	assert.Equal(t, "Machine type tier for MySQL (e.g. db-g1-small, db-f1-micro)", tierFlag.Usage)
+	assert.Equal(t, "Machine type tier, e.g. db-g1-small or db-custom-CPU-RAM_MB (default for sqlserver: db-custom-2-7680)", tierFlag.Usage)
 
 	regionFlag := createCmd.Flags().Lookup("region")
 	assert.NotNil(t, regionFlag)
@@ -38,5 +38,5 @@ func TestInit(t *testing.T) {
 
 	dbVersionFlag := createCmd.Flags().Lookup("dbVersion")
 	assert.NotNil(t, dbVersionFlag)
-	assert.Equal(t, "Database version, e.g. MYSQL_5_7 or MYSQL_8_0", dbVersionFlag.Usage)
+	assert.Equal(t, "Database version, e.g. MYSQL_8_0, POSTGRES_16 or SQLSERVER_2019_STANDARD (default: the engine's default)", dbVersionFlag.Usage)
 }
\ No newline at end of file
@@ -0,0 +1,147 @@
+package unit_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/cmd"
+	"github.com/code4bread/sledge/emulator"
+)
+
+// newEmulatorClient starts an emulator whose operations finish on the next request.
+func newEmulatorClient(t *testing.T, faults ...string) client.Client {
+	t.Helper()
+	opts := emulator.Options{}
+	for _, spec := range faults {
+		f, err := emulator.ParseFault(spec)
+		require.NoError(t, err)
+		opts.Faults = append(opts.Faults, f)
+	}
+	srv, err := emulator.New(opts)
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	c, err := client.New(context.Background(), client.WithEndpoint(ts.URL+"/"))
+	require.NoError(t, err)
+	return c
+}
+
+func TestEmulatorOperationLifecycle(t *testing.T) {
+	ctx := context.Background()
+	c := newEmulatorClient(t)
+
+	op, err := c.InsertInstance(ctx, "demo", &sqladmin.DatabaseInstance{Name: "db1", DatabaseVersion: "MYSQL_8_0"})
+	require.NoError(t, err)
+	assert.Equal(t, "PENDING", op.Status)
+
+	op, err = c.GetOperation(ctx, "demo", op.Name)
+	require.NoError(t, err)
+	assert.Equal(t, "DONE", op.Status)
+
+	inst, err := c.GetInstance(ctx, "demo", "db1")
+	require.NoError(t, err)
+	assert.Equal(t, "RUNNABLE", inst.State)
+
+	_, err = c.InsertInstance(ctx, "demo", &sqladmin.DatabaseInstance{Name: "db1"})
+	assert.Error(t, err)
+}
+
+func TestEmulatorFaults(t *testing.T) {
+	f, err := emulator.ParseFault("backupRuns.insert/db1*2=op:disk full")
+	require.NoError(t, err)
+	assert.Equal(t, emulator.Fault{Method: "backupRuns.insert", Instance: "db1", Times: 2, Message: "disk full"}, f)
+
+	_, err = emulator.ParseFault("instances.get=200:ok")
+	assert.Error(t, err)
+
+	ctx := context.Background()
+	c := newEmulatorClient(t, "backupRuns.insert*1=op:disk full")
+	_, err = c.InsertInstance(ctx, "demo", &sqladmin.DatabaseInstance{Name: "db1"})
+	require.NoError(t, err)
+
+	op, err := c.InsertBackupRun(ctx, "demo", "db1", &sqladmin.BackupRun{Description: "b1"})
+	require.NoError(t, err)
+	op, err = c.GetOperation(ctx, "demo", op.Name)
+	require.NoError(t, err)
+	require.NotNil(t, op.Error)
+	assert.Equal(t, "disk full", op.Error.Errors[0].Message)
+
+	runs, err := c.ListBackupRuns(ctx, "demo", "db1")
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "FAILED", runs[0].Status)
+}
+
+func TestMigrateCrossRegionRestoreAgainstEmulator(t *testing.T) {
+	ctx := context.Background()
+	c := newEmulatorClient(t, "instances.restoreBackup=400:Restore is not supported for cross region")
+	_, err := c.InsertInstance(ctx, "demo", &sqladmin.DatabaseInstance{Name: "src", DatabaseVersion: "MYSQL_8_0"})
+	require.NoError(t, err)
+
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+	setForTest(t, "migrate.sourceProject", "demo")
+	setForTest(t, "migrate.sourceInstance", "src")
+	setForTest(t, "migrate.targetInstance", "dst")
+	setForTest(t, "migrate.targetRegion", "europe-west1")
+	setForTest(t, "migrate.pollInterval", 10*time.Millisecond)
+
+	err = cmd.MigrateCmd.RunE(cmd.MigrateCmd, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cross-region restore may not be supported")
+}
+
+func TestBackupWaitSurfacesOperationErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newEmulatorClient(t, "backupRuns.insert=op:disk full")
+	_, err := c.InsertInstance(ctx, "demo", &sqladmin.DatabaseInstance{Name: "db1"})
+	require.NoError(t, err)
+
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+	setForTest(t, "backup.project", "demo")
+	setForTest(t, "backup.instance", "db1")
+	setForTest(t, "backup.wait", true)
+	setForTest(t, "backup.pollInterval", 10*time.Millisecond)
+
+	err = cmd.BackupCmd.RunE(cmd.BackupCmd, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "INTERNAL_ERROR: disk full")
+}
+
+func TestEmulatorOperationsListAndCancel(t *testing.T) {
+	ctx := context.Background()
+	srv, err := emulator.New(emulator.Options{RunningFor: time.Hour})
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c, err := client.New(ctx, client.WithEndpoint(ts.URL+"/"))
+	require.NoError(t, err)
+
+	op, err := c.InsertInstance(ctx, "demo", &sqladmin.DatabaseInstance{Name: "db1"})
+	require.NoError(t, err)
+
+	ops, err := c.ListOperations(ctx, "demo", "db1")
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "CREATE", ops[0].OperationType)
+	assert.Equal(t, "RUNNING", ops[0].Status)
+
+	require.NoError(t, c.CancelOperation(ctx, "demo", op.Name))
+	op, err = c.GetOperation(ctx, "demo", op.Name)
+	require.NoError(t, err)
+	assert.Equal(t, "DONE", op.Status)
+	require.NotNil(t, op.Error)
+
+	_, err = c.GetInstance(ctx, "demo", "db1")
+	assert.Error(t, err, "a cancelled create should not leave the instance behind")
+	assert.Error(t, c.CancelOperation(ctx, "demo", op.Name))
+}
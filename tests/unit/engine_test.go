@@ -0,0 +1,94 @@
+package unit_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/code4bread/sledge/cmd"
+	"github.com/code4bread/sledge/engine"
+	"github.com/code4bread/sledge/errkind"
+)
+
+func TestEngineValidation(t *testing.T) {
+	eng, err := engine.FromVersion("POSTGRES_16")
+	require.NoError(t, err)
+	assert.Equal(t, engine.Postgres, eng)
+
+	assert.NoError(t, engine.MySQL.ValidateVersion("MYSQL_8_0_31"))
+	assert.Error(t, engine.MySQL.ValidateVersion("POSTGRES_16"))
+	assert.Error(t, engine.Postgres.ValidateVersion("POSTGRES_8"))
+
+	version, err := engine.SQLServer.WithEdition("SQLSERVER_2022", "enterprise")
+	require.NoError(t, err)
+	assert.Equal(t, "SQLSERVER_2022_ENTERPRISE", version)
+	_, err = engine.SQLServer.WithEdition("SQLSERVER_2022_WEB", "EXPRESS")
+	assert.Error(t, err)
+	_, err = engine.Postgres.WithEdition("POSTGRES_16", "STANDARD")
+	assert.Error(t, err)
+
+	cases := []struct {
+		eng  engine.Engine
+		tier string
+		ok   bool
+	}{
+		{engine.MySQL, "db-f1-micro", true},
+		{engine.Postgres, "db-custom-1-3840", true},
+		{engine.Postgres, "db-custom-3-7680", false},  // odd vCPUs
+		{engine.Postgres, "db-custom-2-7000", false},  // not a multiple of 256 MB
+		{engine.Postgres, "db-custom-2-15360", false}, // above 6.5 GB per vCPU
+		{engine.SQLServer, "db-custom-2-7680", true},
+		{engine.SQLServer, "db-f1-micro", false},
+		{engine.SQLServer, "db-n1-standard-2", false},
+		{engine.SQLServer, "db-custom-1-3840", false},
+	}
+	for _, c := range cases {
+		err := c.eng.ValidateTier(c.tier)
+		assert.Equal(t, c.ok, err == nil, "%s %s: %v", c.eng, c.tier, err)
+	}
+}
+
+func TestCreateEngineFlagPicksEngineDefaultVersion(t *testing.T) {
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+
+	// Set through the flag, not an override, as on the command line.
+	engineFlag := cmd.CreateCmd.Flags().Lookup("engine")
+	require.NoError(t, cmd.CreateCmd.Flags().Set("engine", "postgres"))
+	t.Cleanup(func() {
+		engineFlag.Value.Set("")
+		engineFlag.Changed = false
+	})
+	setForTest(t, "create.project", "p")
+	setForTest(t, "create.instance", "pg")
+
+	require.NoError(t, cmd.CreateCmd.RunE(cmd.CreateCmd, nil))
+	inst, err := c.GetInstance(context.Background(), "p", "pg")
+	require.NoError(t, err)
+	assert.Equal(t, "POSTGRES_16", inst.DatabaseVersion)
+}
+
+func TestCreateSQLServerUsesEngineDefaults(t *testing.T) {
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+
+	setForTest(t, "create.project", "p")
+	setForTest(t, "create.instance", "mssql")
+	setForTest(t, "create.engine", "sqlserver")
+	setForTest(t, "create.edition", "express")
+
+	err := cmd.CreateCmd.RunE(cmd.CreateCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.Validation), "missing root password: %v", err)
+
+	setForTest(t, "create.rootPassword", "s3cret")
+	require.NoError(t, cmd.CreateCmd.RunE(cmd.CreateCmd, nil))
+
+	inst, err := c.GetInstance(context.Background(), "p", "mssql")
+	require.NoError(t, err)
+	assert.Equal(t, "SQLSERVER_2019_EXPRESS", inst.DatabaseVersion)
+	assert.Equal(t, "db-custom-2-7680", inst.Settings.Tier)
+}
@@ -0,0 +1,52 @@
+package unit_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/cmd"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/waiter"
+)
+
+func apiError(code int, reason string) error {
+	return fmt.Errorf("wrapped: %w", &googleapi.Error{Code: code, Errors: []googleapi.ErrorItem{{Reason: reason}}})
+}
+
+func TestErrorKinds(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind errkind.Kind
+		exit int
+	}{
+		{errors.New("boom"), errkind.Unknown, 1},
+		{errkind.Validationf("--project is required"), errkind.Validation, 2},
+		{apiError(404, "instanceDoesNotExist"), errkind.NotFound, 3},
+		{apiError(409, "instanceAlreadyExists"), errkind.AlreadyExists, 4},
+		{apiError(403, "forbidden"), errkind.PermissionDenied, 5},
+		{apiError(403, "quotaExceeded"), errkind.Quota, 6},
+		{apiError(429, "rateLimitExceeded"), errkind.Quota, 6},
+		{apiError(409, "operationInProgress"), errkind.Conflict, 7},
+		{fmt.Errorf("wait: %w", &waiter.TimeoutError{Operation: "op"}), errkind.Timeout, 8},
+		{&waiter.OperationError{Operation: &sqladmin.Operation{Error: &sqladmin.OperationErrors{}}}, errkind.OperationFailed, 9},
+		{fmt.Errorf("%w: %v", cmd.ErrInterrupted, context.Canceled), errkind.Interrupted, 130},
+		{errkind.New(errkind.ChangesPending, errors.New("2 changes pending")), errkind.ChangesPending, 10},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.kind, errkind.Of(c.err), c.err.Error())
+		assert.Equal(t, c.exit, cmd.ExitCode(c.err), c.err.Error())
+	}
+	assert.Equal(t, 0, cmd.ExitCode(nil))
+}
+
+func TestEmulatorErrorsAreClassified(t *testing.T) {
+	c := newEmulatorClient(t)
+	_, err := c.GetInstance(context.Background(), "p", "missing")
+	assert.True(t, errkind.Is(err, errkind.NotFound))
+}
@@ -0,0 +1,106 @@
+package unit_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/cmd"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/logger"
+)
+
+// stallingClient never finishes the first operation it is asked about, so
+// the command waiting for it is still running when the test interrupts it.
+type stallingClient struct {
+	client.Client
+	once    sync.Once
+	stalled chan struct{}
+}
+
+func (c *stallingClient) GetOperation(ctx context.Context, project, operation string) (*sqladmin.Operation, error) {
+	first := false
+	c.once.Do(func() {
+		first = true
+		close(c.stalled)
+	})
+	if first {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return c.Client.GetOperation(ctx, project, operation)
+}
+
+// captureLog sends log output to a buffer for the duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger.Logger.SetOutput(&buf)
+	t.Cleanup(func() { logger.Logger.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestInterruptReportsInFlightWorkAndCleansUpOnSecondSignal(t *testing.T) {
+	ctx := context.Background()
+	c := &stallingClient{Client: newEmulatorClient(t), stalled: make(chan struct{})}
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+	logs := captureLog(t)
+
+	setForTest(t, "create.project", "p")
+	setForTest(t, "create.instance", "db")
+	setForTest(t, "create.region", "us-central1")
+	setForTest(t, "create.wait", true)
+	setForTest(t, "create.pollInterval", time.Millisecond)
+	setForTest(t, "cleanupOnInterrupt", true)
+
+	signals := make(chan os.Signal, 2)
+	go func() {
+		<-c.stalled
+		signals <- os.Interrupt
+		signals <- os.Interrupt
+	}()
+	err := cmd.RunInterruptible(signals, func(ctx context.Context) error {
+		cmd.CreateCmd.SetContext(ctx)
+		defer cmd.CreateCmd.SetContext(context.Background())
+		return cmd.CreateCmd.RunE(cmd.CreateCmd, nil)
+	})
+	assert.True(t, errors.Is(err, cmd.ErrInterrupted), "interrupted create: %v", err)
+	assert.Equal(t, 130, cmd.ExitCode(err))
+
+	assert.Contains(t, logs.String(), "still in flight")
+	assert.Contains(t, logs.String(), "instance db in project p (cleanup: delete instance db)")
+	_, err = c.GetInstance(ctx, "p", "db")
+	assert.True(t, errkind.Is(err, errkind.NotFound), "instance cleaned up: %v", err)
+}
+
+func TestEmulatorStopsOnInterrupt(t *testing.T) {
+	captureLog(t)
+	setForTest(t, "emulator.addr", "127.0.0.1:0")
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.RunInterruptible(signals, func(ctx context.Context) error {
+			cmd.EmulatorCmd.SetContext(ctx)
+			defer cmd.EmulatorCmd.SetContext(context.Background())
+			return cmd.EmulatorCmd.RunE(cmd.EmulatorCmd, nil)
+		})
+	}()
+	signals <- os.Interrupt
+
+	select {
+	case err := <-done:
+		assert.True(t, errors.Is(err, cmd.ErrInterrupted), "interrupted emulator: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("emulator kept serving after the interrupt")
+	}
+}
@@ -0,0 +1,63 @@
+package unit_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/cmd"
+)
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	fnErr := fn()
+	os.Stdout = stdout
+	w.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data), fnErr
+}
+
+func TestListFansOutAndFilters(t *testing.T) {
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+
+	ctx := context.Background()
+	for _, inst := range []struct{ project, name, region, env string }{
+		{"proj-a", "db-a", "us-central1", "prod"},
+		{"proj-b", "db-b1", "us-central1", "dev"},
+		{"proj-b", "db-b2", "europe-west1", "prod"},
+	} {
+		_, err := c.InsertInstance(ctx, inst.project, &sqladmin.DatabaseInstance{
+			Name:     inst.name,
+			Region:   inst.region,
+			Settings: &sqladmin.Settings{Tier: "db-f1-micro", UserLabels: map[string]string{"env": inst.env}},
+		})
+		require.NoError(t, err)
+	}
+
+	setForTest(t, "list.project", []string{"proj-b", "proj-a"})
+	setForTest(t, "list.label", []string{"env=prod"})
+	setForTest(t, "output", "json")
+
+	out, err := captureStdout(t, func() error { return cmd.ListCmd.RunE(cmd.ListCmd, nil) })
+	require.NoError(t, err)
+
+	var instances []*sqladmin.DatabaseInstance
+	require.NoError(t, json.Unmarshal([]byte(out), &instances))
+	require.Len(t, instances, 2)
+	assert.Equal(t, "db-a", instances[0].Name)
+	assert.Equal(t, "db-b2", instances[1].Name)
+}
@@ -0,0 +1,56 @@
+package unit_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/code4bread/sledge/output"
+)
+
+type result struct {
+	Instance  string `json:"instance"`
+	Operation string `json:"operation"`
+	BackupRun int64  `json:"backupRunId,omitempty"`
+}
+
+func resultTable(wide bool) ([]string, [][]string) {
+	header := []string{"INSTANCE", "OPERATION"}
+	row := []string{"db1", "op-1"}
+	if wide {
+		header, row = append(header, "BACKUP_RUN_ID"), append(row, "7")
+	}
+	return header, [][]string{row}
+}
+
+func render(t *testing.T, format string, table output.TableFunc) string {
+	t.Helper()
+	f, err := output.Parse(format)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, output.Write(&buf, f, result{Instance: "db1", Operation: "op-1", BackupRun: 7}, table))
+	return buf.String()
+}
+
+func TestOutputFormats(t *testing.T) {
+	assert.Equal(t, "{\n  \"instance\": \"db1\",\n  \"operation\": \"op-1\",\n  \"backupRunId\": 7\n}\n", render(t, "json", nil))
+	assert.Equal(t, "instance: db1\noperation: op-1\nbackupRunId: 7\n", render(t, "yaml", nil))
+	assert.Equal(t, "op-1/7\n", render(t, "template={{.operation}}/{{.backupRunId}}", nil))
+	assert.Equal(t, "INSTANCE  OPERATION\ndb1       op-1\n", render(t, "table", resultTable))
+	assert.Equal(t, "INSTANCE  OPERATION  BACKUP_RUN_ID\ndb1       op-1       7\n", render(t, "wide", resultTable))
+}
+
+func TestOutputErrors(t *testing.T) {
+	_, err := output.Parse("xml")
+	assert.Error(t, err)
+	_, err = output.Parse("template=")
+	assert.Error(t, err)
+	_, err = output.Parse("template={{.bad")
+	assert.Error(t, err)
+
+	f, err := output.Parse("table")
+	require.NoError(t, err)
+	assert.Error(t, output.Write(&bytes.Buffer{}, f, result{}, nil))
+}
@@ -0,0 +1,65 @@
+package unit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+)
+
+func newRetryingClient(t *testing.T, retries *[]client.Retry, faults ...string) client.Client {
+	t.Helper()
+	return client.NewRetrying(newEmulatorClient(t, faults...), client.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		RetryConflicts: true,
+		OnRetry:        func(r client.Retry) { *retries = append(*retries, r) },
+	})
+}
+
+func TestRetryingClientRetriesSafeFailures(t *testing.T) {
+	var retries []client.Retry
+	c := newRetryingClient(t, &retries,
+		"instances.insert*1=503:backend unavailable",
+		"instances.insert*1=409:another operation is in progress")
+
+	_, err := c.InsertInstance(context.Background(), "p", &sqladmin.DatabaseInstance{Name: "db1", Region: "us-central1"})
+	require.NoError(t, err)
+	require.Len(t, retries, 2)
+	assert.Equal(t, "instances.insert", retries[0].Method)
+	assert.Equal(t, 2, retries[1].Attempt)
+}
+
+func TestRetryingClientDoesNotRepeatAmbiguousInserts(t *testing.T) {
+	var retries []client.Retry
+	c := newRetryingClient(t, &retries, "backupRuns.insert*1=502:bad gateway", "instances.delete*1=502:bad gateway",
+		"instances.get*2=502:bad gateway")
+
+	_, err := c.InsertBackupRun(context.Background(), "p", "db1", &sqladmin.BackupRun{})
+	assert.Error(t, err)
+	assert.Empty(t, retries)
+
+	// Nor deletes, which may have gone through.
+	_, err = c.DeleteInstance(context.Background(), "p", "db1")
+	assert.Error(t, err)
+	assert.Empty(t, retries)
+
+	// Reads are idempotent, so the same error is retried.
+	_, err = c.GetInstance(context.Background(), "p", "db1")
+	assert.Len(t, retries, 2)
+	assert.Error(t, err, "db1 does not exist")
+}
+
+func TestRetryingClientGivesUpAfterMaxAttempts(t *testing.T) {
+	var retries []client.Retry
+	c := newRetryingClient(t, &retries, "operations.list=429:slow down")
+
+	_, err := c.ListOperations(context.Background(), "p", "")
+	assert.Error(t, err)
+	assert.Len(t, retries, 2)
+}
@@ -0,0 +1,130 @@
+package unit_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/code4bread/sledge/cmd"
+	"github.com/code4bread/sledge/errkind"
+	"github.com/code4bread/sledge/spec"
+)
+
+const settingsYAML = `
+tier: db-custom-2-7680
+storage:
+  sizeGb: 100
+  type: ssd
+  autoResizeLimitGb: 500
+availabilityType: REGIONAL
+zone: us-central1-a
+secondaryZone: us-central1-c
+backup:
+  enabled: true
+  startTime: "03:00"
+  pointInTimeRecovery: true
+maintenance:
+  day: SUN
+  hour: 0
+flags:
+  max_connections: 500
+labels:
+  team: payments
+`
+
+func TestCreateAppliesSettingsFileAndFlags(t *testing.T) {
+	path := writeTemp(t, settingsYAML)
+
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+
+	setForTest(t, "create.project", "p")
+	setForTest(t, "create.instance", "ha")
+	setForTest(t, "create.region", "us-central1")
+	setForTest(t, "create.settingsFile", path)
+	setForTest(t, "create.labels", []string{"env=prod"})
+	setForTest(t, "create.deletionProtection", true)
+	require.NoError(t, cmd.CreateCmd.RunE(cmd.CreateCmd, nil))
+
+	inst, err := c.GetInstance(context.Background(), "p", "ha")
+	require.NoError(t, err)
+	s := inst.Settings
+	assert.Equal(t, "db-custom-2-7680", s.Tier)
+	assert.Equal(t, int64(100), s.DataDiskSizeGb)
+	assert.Equal(t, "PD_SSD", s.DataDiskType)
+	assert.Equal(t, int64(500), s.StorageAutoResizeLimit)
+	assert.Equal(t, "REGIONAL", s.AvailabilityType)
+	assert.Equal(t, "us-central1-c", s.LocationPreference.SecondaryZone)
+	assert.True(t, s.BackupConfiguration.BinaryLogEnabled, "MySQL PITR uses binary logs")
+	assert.Equal(t, "03:00", s.BackupConfiguration.StartTime)
+	assert.Equal(t, int64(7), s.MaintenanceWindow.Day)
+	require.Len(t, s.DatabaseFlags, 1)
+	assert.Equal(t, "500", s.DatabaseFlags[0].Value)
+	assert.Equal(t, map[string]string{"team": "payments", "env": "prod"}, s.UserLabels)
+	assert.True(t, s.DeletionProtectionEnabled)
+
+	setForTest(t, "create.instance", "bad")
+	setForTest(t, "create.zone", "europe-west1-b")
+	err = cmd.CreateCmd.RunE(cmd.CreateCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.Validation), "zone outside region: %v", err)
+}
+
+func TestSettingsValidation(t *testing.T) {
+	enabled := true
+	for _, s := range []spec.Settings{
+		{Storage: spec.Storage{Type: "NVME"}},
+		{Storage: spec.Storage{SizeGB: 100, AutoResizeLimitGB: 50}},
+		{AvailabilityType: "ZONAL", Zone: "us-central1-a", SecondaryZone: "us-central1-b"},
+		{Backup: spec.Backup{PointInTimeRecovery: &enabled}},
+		{Backup: spec.Backup{Enabled: &enabled, StartTime: "3am"}},
+		{Maintenance: spec.Maintenance{Day: "FUNDAY"}},
+		{Labels: map[string]string{"Team": "x"}},
+	} {
+		assert.Error(t, s.Validate("us-central1"), "%+v", s)
+	}
+
+	_, err := spec.LoadSettings(writeTemp(t, "storage:\n  sizeGB: 10\n"))
+	assert.ErrorContains(t, err, "sizeGB")
+}
+
+func writeTemp(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestNetworkValidation(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/8", "203.0.113.7", "0.0.0.0/0"} {
+		assert.NoError(t, spec.Network{AuthorizedNetworks: []string{cidr}}.Validate(), cidr)
+	}
+	for _, cidr := range []string{"10.0.0.1/8", "10.0.0.0/33", "2001:db8::/32", "office"} {
+		assert.Error(t, spec.Network{AuthorizedNetworks: []string{cidr}}.Validate(), cidr)
+	}
+	assert.Error(t, spec.Network{SSLMode: "REQUIRED"}.Validate())
+	assert.Equal(t, "projects/p/global/networks/default", spec.NetworkPath("p", "default"))
+
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+	setForTest(t, "create.project", "p")
+	setForTest(t, "create.instance", "private")
+	setForTest(t, "create.publicIp", false)
+	err := cmd.CreateCmd.RunE(cmd.CreateCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.Validation), "no public or private IP: %v", err)
+
+	setForTest(t, "create.privateNetwork", "default")
+	setForTest(t, "create.sslMode", "encrypted_only")
+	require.NoError(t, cmd.CreateCmd.RunE(cmd.CreateCmd, nil))
+	inst, err := c.GetInstance(context.Background(), "p", "private")
+	require.NoError(t, err)
+	ip := inst.Settings.IpConfiguration
+	assert.False(t, ip.Ipv4Enabled)
+	assert.Equal(t, "projects/p/global/networks/default", ip.PrivateNetwork)
+	assert.Equal(t, "ENCRYPTED_ONLY", ip.SslMode)
+}
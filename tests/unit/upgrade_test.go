@@ -0,0 +1,212 @@
+package unit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/client"
+	"github.com/code4bread/sledge/cmd"
+	"github.com/code4bread/sledge/engine"
+	"github.com/code4bread/sledge/errkind"
+)
+
+func TestUpgradePaths(t *testing.T) {
+	cases := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"MYSQL_5_7", "MYSQL_8_0", true},
+		{"MYSQL_5_7", "MYSQL_8_0_36", true},
+		{"MYSQL_8_0_31", "MYSQL_8_0_36", true},
+		{"MYSQL_8_0", "MYSQL_8_4", true},
+		{"MYSQL_5_6", "MYSQL_8_0", false}, // one major version at a time
+		{"MYSQL_8_0", "MYSQL_5_6", false}, // downgrade
+		{"MYSQL_8_0_36", "MYSQL_8_0_31", false},
+		{"MYSQL_8_0", "POSTGRES_16", false},
+		{"POSTGRES_13", "POSTGRES_16", true},
+		{"POSTGRES_16", "POSTGRES_15", false},
+		{"POSTGRES_18", "POSTGRES_17", false}, // unknown from, not a way around the downgrade check
+		{"MYSQL_9_0", "MYSQL_8_4", false},
+		{"SQLSERVER_2019_STANDARD", "SQLSERVER_2022_STANDARD", true},
+		{"SQLSERVER_2019_STANDARD", "SQLSERVER_2022_ENTERPRISE", false},
+	}
+	for _, c := range cases {
+		err := engine.ValidateUpgrade(c.from, c.to)
+		assert.Equal(t, c.ok, err == nil, "%s -> %s: %v", c.from, c.to, err)
+	}
+
+	assert.Equal(t, []string{"MYSQL_8_0"}, engine.UpgradeTargets("MYSQL_5_7"))
+	assert.True(t, engine.IsMajorUpgrade("MYSQL_5_7", "MYSQL_8_0_36"))
+	assert.False(t, engine.IsMajorUpgrade("MYSQL_8_0", "MYSQL_8_0_36"))
+	assert.Len(t, engine.IncompatibleFlags("MYSQL_5_7", "MYSQL_8_0", []string{"query_cache_type", "max_connections"}), 1)
+}
+
+func TestUpgradeSendsMajorVersionUpgradeAlone(t *testing.T) {
+	ctx := context.Background()
+	c := newEmulatorClient(t)
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+
+	op, err := c.InsertInstance(ctx, "p", &sqladmin.DatabaseInstance{Name: "db", DatabaseVersion: "MYSQL_5_7"})
+	require.NoError(t, err)
+	_, err = c.GetOperation(ctx, "p", op.Name)
+	require.NoError(t, err)
+
+	setForTest(t, "upgrade.project", "p")
+	setForTest(t, "upgrade.instance", "db")
+	setForTest(t, "upgrade.pollInterval", time.Millisecond)
+	setForTest(t, "upgrade.timeout", time.Minute)
+	setForTest(t, "upgrade.wait", true)
+
+	setForTest(t, "upgrade.dbVersion", "MYSQL_8_4")
+	err = cmd.UpgradeCmd.RunE(cmd.UpgradeCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.Validation), "skipping 8.0: %v", err)
+
+	setForTest(t, "upgrade.dbVersion", "MYSQL_8_0")
+	setForTest(t, "upgrade.tier", "db-n1-standard-2")
+	require.NoError(t, cmd.UpgradeCmd.RunE(cmd.UpgradeCmd, nil))
+	inst, err := c.GetInstance(ctx, "p", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "MYSQL_8_0", inst.DatabaseVersion)
+	assert.Equal(t, "db-n1-standard-2", inst.Settings.Tier)
+
+	ops, err := c.ListOperations(ctx, "p", "db")
+	require.NoError(t, err)
+	var types []string
+	for _, op := range ops {
+		types = append(types, op.OperationType)
+	}
+	assert.Contains(t, types, "MAJOR_VERSION_UPGRADE")
+
+	// Minor versions are not in upgradableDatabaseVersions but can be
+	// upgraded to.
+	require.NotEmpty(t, inst.UpgradableDatabaseVersions)
+	setForTest(t, "upgrade.dbVersion", "MYSQL_8_0_36")
+	setForTest(t, "upgrade.tier", "")
+	require.NoError(t, cmd.UpgradeCmd.RunE(cmd.UpgradeCmd, nil))
+	inst, err = c.GetInstance(ctx, "p", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "MYSQL_8_0_36", inst.DatabaseVersion)
+
+	setForTest(t, "upgrade.dbVersion", "MYSQL_5_7")
+	err = cmd.UpgradeCmd.RunE(cmd.UpgradeCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.Validation), "downgrade: %v", err)
+}
+
+// racingClient changes the instance behind the caller's back just before
+// its first patch, like a colleague editing it in the console.
+type racingClient struct {
+	client.Client
+	race    *sqladmin.DatabaseInstance
+	patches []*sqladmin.DatabaseInstance
+}
+
+func (c *racingClient) PatchInstance(ctx context.Context, project, instance string, inst *sqladmin.DatabaseInstance) (*sqladmin.Operation, error) {
+	if c.race != nil {
+		op, err := c.Client.PatchInstance(ctx, project, instance, c.race)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.Client.GetOperation(ctx, project, op.Name); err != nil {
+			return nil, err
+		}
+		c.race = nil
+	}
+	c.patches = append(c.patches, inst)
+	return c.Client.PatchInstance(ctx, project, instance, inst)
+}
+
+func TestUpgradeSendsMinimalPatchAndHandlesConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	c := &racingClient{Client: newEmulatorClient(t)}
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+
+	op, err := c.InsertInstance(ctx, "p", &sqladmin.DatabaseInstance{Name: "db", DatabaseVersion: "POSTGRES_15",
+		Settings: &sqladmin.Settings{Tier: "db-f1-micro"}})
+	require.NoError(t, err)
+	_, err = c.GetOperation(ctx, "p", op.Name)
+	require.NoError(t, err)
+
+	setForTest(t, "upgrade.project", "p")
+	setForTest(t, "upgrade.instance", "db")
+	setForTest(t, "upgrade.pollInterval", time.Millisecond)
+	setForTest(t, "upgrade.timeout", time.Minute)
+	setForTest(t, "upgrade.wait", true)
+
+	// A label added meanwhile does not overlap: retried and kept.
+	c.race = &sqladmin.DatabaseInstance{Settings: &sqladmin.Settings{UserLabels: map[string]string{"team": "payments"}}}
+	setForTest(t, "upgrade.tier", "db-custom-2-7680")
+	require.NoError(t, cmd.UpgradeCmd.RunE(cmd.UpgradeCmd, nil))
+	require.Len(t, c.patches, 2)
+	first := c.patches[0]
+	assert.Empty(t, first.Name)
+	assert.Empty(t, first.DatabaseVersion)
+	assert.Equal(t, "db-custom-2-7680", first.Settings.Tier)
+	assert.Nil(t, first.Settings.UserLabels)
+	assert.NotZero(t, first.Settings.SettingsVersion)
+	inst, err := c.GetInstance(ctx, "p", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "db-custom-2-7680", inst.Settings.Tier)
+	assert.Equal(t, "payments", inst.Settings.UserLabels["team"])
+
+	// A tier changed meanwhile would be overwritten: a Conflict.
+	c.race = &sqladmin.DatabaseInstance{Settings: &sqladmin.Settings{Tier: "db-custom-4-15360"}}
+	setForTest(t, "upgrade.tier", "db-custom-8-30720")
+	err = cmd.UpgradeCmd.RunE(cmd.UpgradeCmd, nil)
+	assert.True(t, errkind.Is(err, errkind.Conflict), "overlapping change: %v", err)
+	inst, err = c.GetInstance(ctx, "p", "db")
+	require.NoError(t, err)
+	assert.Equal(t, "db-custom-4-15360", inst.Settings.Tier)
+}
+
+func TestUpgradeRollsBackToPreUpgradeBackup(t *testing.T) {
+	ctx := context.Background()
+	c := newEmulatorClient(t, "instances.patch*1=op:upgrade failed")
+	cmd.SetClient(c)
+	t.Cleanup(func() { cmd.SetClient(nil) })
+
+	op, err := c.InsertInstance(ctx, "p", &sqladmin.DatabaseInstance{Name: "db", DatabaseVersion: "POSTGRES_15"})
+	require.NoError(t, err)
+	_, err = c.GetOperation(ctx, "p", op.Name)
+	require.NoError(t, err)
+
+	setForTest(t, "upgrade.project", "p")
+	setForTest(t, "upgrade.instance", "db")
+	setForTest(t, "upgrade.pollInterval", time.Millisecond)
+	setForTest(t, "upgrade.timeout", time.Minute)
+	setForTest(t, "upgrade.dbVersion", "POSTGRES_16")
+	setForTest(t, "upgrade.rollback", true)
+	setForTest(t, "output", "json")
+
+	out, err := captureStdout(t, func() error { return cmd.UpgradeCmd.RunE(cmd.UpgradeCmd, nil) })
+	require.True(t, errkind.Is(err, errkind.OperationFailed), "failed upgrade: %v", err)
+	assert.Contains(t, err.Error(), "restored from pre-upgrade backup run")
+	assert.Contains(t, out, `"backupRunId"`, "the backup run ID is printed on failure too")
+	assert.Contains(t, out, `"operationType": "MAJOR_VERSION_UPGRADE"`)
+	runs, err := c.ListBackupRuns(ctx, "p", "db")
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+
+	ops, err := c.ListOperations(ctx, "p", "db")
+	require.NoError(t, err)
+	var types []string
+	for _, op := range ops {
+		types = append(types, op.OperationType)
+	}
+	assert.Contains(t, types, "BACKUP_VOLUME")
+	assert.Contains(t, types, "RESTORE_VOLUME")
+
+	// The second patch succeeds; --backup waits for it without --wait.
+	setForTest(t, "upgrade.rollback", false)
+	setForTest(t, "upgrade.backup", true)
+	out, err = captureStdout(t, func() error { return cmd.UpgradeCmd.RunE(cmd.UpgradeCmd, nil) })
+	require.NoError(t, err)
+	assert.Contains(t, out, `"backupRunId"`)
+	assert.Contains(t, out, `"status": "DONE"`)
+}
@@ -0,0 +1,98 @@
+package unit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sqladmin/v1"
+
+	"github.com/code4bread/sledge/waiter"
+)
+
+// scriptedGetter returns the queued results in order, repeating the last one.
+type scriptedGetter struct {
+	results []func() (*sqladmin.Operation, error)
+	calls   int
+}
+
+func (g *scriptedGetter) GetOperation(ctx context.Context, project, operation string) (*sqladmin.Operation, error) {
+	i := g.calls
+	if i >= len(g.results) {
+		i = len(g.results) - 1
+	}
+	g.calls++
+	return g.results[i]()
+}
+
+func opWithStatus(status string) func() (*sqladmin.Operation, error) {
+	return func() (*sqladmin.Operation, error) {
+		return &sqladmin.Operation{Name: "op1", OperationType: "CREATE", Status: status}, nil
+	}
+}
+
+func failWith(code int) func() (*sqladmin.Operation, error) {
+	return func() (*sqladmin.Operation, error) { return nil, &googleapi.Error{Code: code} }
+}
+
+var fastPolling = waiter.Options{InitialInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+
+func TestWaiterRetriesTransientErrorsAndReportsProgress(t *testing.T) {
+	g := &scriptedGetter{results: []func() (*sqladmin.Operation, error){
+		opWithStatus("PENDING"), failWith(503), failWith(429), opWithStatus("RUNNING"), opWithStatus("DONE"),
+	}}
+	var statuses []string
+	opts := fastPolling
+	opts.OnProgress = func(p waiter.Progress) { statuses = append(statuses, p.Status()) }
+
+	op, err := waiter.New(g, opts).Wait(context.Background(), "demo", "op1")
+	require.NoError(t, err)
+	assert.Equal(t, "DONE", op.Status)
+	assert.Equal(t, []string{"PENDING", "RUNNING", "DONE"}, statuses)
+}
+
+func TestWaiterFailsOnPermanentError(t *testing.T) {
+	g := &scriptedGetter{results: []func() (*sqladmin.Operation, error){failWith(403)}}
+	_, err := waiter.New(g, fastPolling).Wait(context.Background(), "demo", "op1")
+	var gerr *googleapi.Error
+	require.True(t, errors.As(err, &gerr))
+	assert.Equal(t, 403, gerr.Code)
+	assert.Equal(t, 1, g.calls)
+}
+
+func TestWaiterReturnsOperationErrors(t *testing.T) {
+	g := &scriptedGetter{results: []func() (*sqladmin.Operation, error){func() (*sqladmin.Operation, error) {
+		return &sqladmin.Operation{Name: "op1", Status: "DONE", Error: &sqladmin.OperationErrors{
+			Errors: []*sqladmin.OperationError{{Code: "QUOTA_EXCEEDED", Message: "out of quota"}},
+		}}, nil
+	}}}
+	_, err := waiter.New(g, fastPolling).Wait(context.Background(), "demo", "op1")
+	var opErr *waiter.OperationError
+	require.True(t, errors.As(err, &opErr))
+	assert.Equal(t, []string{"QUOTA_EXCEEDED"}, opErr.Codes())
+	assert.Contains(t, err.Error(), "QUOTA_EXCEEDED: out of quota")
+}
+
+func TestWaiterTimeoutAndCancellation(t *testing.T) {
+	g := &scriptedGetter{results: []func() (*sqladmin.Operation, error){opWithStatus("RUNNING")}}
+
+	opts := fastPolling
+	opts.Timeout = 20 * time.Millisecond
+	_, err := waiter.New(g, opts).Wait(context.Background(), "demo", "op1")
+	var timeoutErr *waiter.TimeoutError
+	require.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, "RUNNING", timeoutErr.LastStatus)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	slow := waiter.Options{InitialInterval: time.Hour}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err = waiter.New(g, slow).Wait(ctx, "demo", "op1")
+	assert.ErrorIs(t, err, context.Canceled)
+}
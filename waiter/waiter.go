@@ -0,0 +1,218 @@
+// Package waiter polls Cloud SQL operations until they finish, backing off
+// between polls, retrying transient API errors and honouring context
+// cancellation.
+package waiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sqladmin/v1"
+)
+
+// Getter fetches an operation. client.Client satisfies it.
+type Getter interface {
+	GetOperation(ctx context.Context, project, operation string) (*sqladmin.Operation, error)
+}
+
+// Progress is reported after every successful poll.
+type Progress struct {
+	Operation *sqladmin.Operation
+	// Elapsed is the time since Wait was called.
+	Elapsed time.Duration
+	// Polls is the number of polls made so far, including this one.
+	Polls int
+}
+
+// Status returns the operation status, e.g. PENDING, RUNNING or DONE.
+func (p Progress) Status() string { return p.Operation.Status }
+
+// Type returns the operation type, e.g. CREATE or BACKUP_VOLUME.
+func (p Progress) Type() string { return p.Operation.OperationType }
+
+// Options configures a Waiter. Zero values take the defaults noted below.
+type Options struct {
+	// InitialInterval is the delay before the second poll (default 2s).
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between polls (default 30s).
+	MaxInterval time.Duration
+	// Multiplier grows the delay after every poll (default 1.5).
+	Multiplier float64
+	// Jitter randomises each delay by up to this fraction (default 0.2).
+	Jitter float64
+	// Timeout bounds the whole wait; 0 waits until ctx is done.
+	Timeout time.Duration
+	// MaxTransientErrors is how many consecutive transient errors are
+	// retried before giving up (default 5).
+	MaxTransientErrors int
+	// OnProgress, if set, is called after every successful poll.
+	OnProgress func(Progress)
+}
+
+// Waiter polls operations with exponential backoff.
+type Waiter struct {
+	getter Getter
+	opts   Options
+}
+
+// New returns a Waiter using getter to fetch operations.
+func New(getter Getter, opts Options) *Waiter {
+	if opts.InitialInterval <= 0 {
+		opts.InitialInterval = 2 * time.Second
+	}
+	if opts.MaxInterval <= 0 {
+		opts.MaxInterval = 30 * time.Second
+	}
+	if opts.MaxInterval < opts.InitialInterval {
+		opts.MaxInterval = opts.InitialInterval
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = 1.5
+	}
+	if opts.Jitter <= 0 || opts.Jitter >= 1 {
+		opts.Jitter = 0.2
+	}
+	if opts.MaxTransientErrors <= 0 {
+		opts.MaxTransientErrors = 5
+	}
+	return &Waiter{getter: getter, opts: opts}
+}
+
+// OperationError is returned when an operation finishes with errors.
+type OperationError struct {
+	Operation *sqladmin.Operation
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %s (%s) finished with errors: %s",
+		e.Operation.Name, e.Operation.OperationType, FormatErrors(e.Operation.Error))
+}
+
+// Codes returns the error codes reported by the operation.
+func (e *OperationError) Codes() []string {
+	var codes []string
+	for _, oe := range e.Operation.Error.Errors {
+		codes = append(codes, oe.Code)
+	}
+	return codes
+}
+
+// TimeoutError is returned when the operation is not DONE within Options.Timeout.
+type TimeoutError struct {
+	Operation string
+	Timeout   time.Duration
+	// LastStatus is the last status observed, empty if no poll succeeded.
+	LastStatus string
+}
+
+func (e *TimeoutError) Error() string {
+	if e.LastStatus == "" {
+		return fmt.Sprintf("operation %s did not complete before timeout of %s", e.Operation, e.Timeout)
+	}
+	return fmt.Sprintf("operation %s did not complete before timeout of %s (last status %s)",
+		e.Operation, e.Timeout, e.LastStatus)
+}
+
+// FormatErrors renders the errors reported by a finished operation as
+// "CODE: message; CODE: message".
+func FormatErrors(errs *sqladmin.OperationErrors) string {
+	if errs == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(errs.Errors))
+	for _, e := range errs.Errors {
+		switch {
+		case e.Code != "" && e.Message != "":
+			parts = append(parts, fmt.Sprintf("%s: %s", e.Code, e.Message))
+		case e.Message != "":
+			parts = append(parts, e.Message)
+		default:
+			parts = append(parts, e.Code)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// IsTransient reports whether err is worth retrying: rate limiting, server
+// errors and network timeouts.
+func IsTransient(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch gerr.Code {
+		case 429, 500, 502, 503, 504:
+			return true
+		}
+		return false
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// Wait polls the operation until it is DONE. It returns the finished
+// operation, an *OperationError if it finished with errors, a *TimeoutError
+// if Options.Timeout passed, or ctx.Err() (wrapped) if ctx was cancelled.
+func (w *Waiter) Wait(ctx context.Context, project, name string) (*sqladmin.Operation, error) {
+	start := time.Now()
+	var deadline <-chan time.Time
+	if w.opts.Timeout > 0 {
+		timer := time.NewTimer(w.opts.Timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	interval := w.opts.InitialInterval
+	transient := 0
+	polls := 0
+	lastStatus := ""
+	for {
+		op, err := w.getter.GetOperation(ctx, project, name)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return nil, fmt.Errorf("stopped waiting for operation %s: %w", name, ctx.Err())
+		case err != nil && IsTransient(err) && transient < w.opts.MaxTransientErrors:
+			transient++
+		case err != nil:
+			return nil, fmt.Errorf("failed to get operation %s: %w", name, err)
+		default:
+			transient = 0
+			polls++
+			lastStatus = op.Status
+			if w.opts.OnProgress != nil {
+				w.opts.OnProgress(Progress{Operation: op, Elapsed: time.Since(start), Polls: polls})
+			}
+			if op.Status == "DONE" {
+				if op.Error != nil && len(op.Error.Errors) > 0 {
+					return op, &OperationError{Operation: op}
+				}
+				return op, nil
+			}
+		}
+
+		timer := time.NewTimer(w.jitter(interval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("stopped waiting for operation %s: %w", name, ctx.Err())
+		case <-deadline:
+			timer.Stop()
+			return nil, &TimeoutError{Operation: name, Timeout: w.opts.Timeout, LastStatus: lastStatus}
+		case <-timer.C:
+		}
+		interval = time.Duration(float64(interval) * w.opts.Multiplier)
+		if interval > w.opts.MaxInterval {
+			interval = w.opts.MaxInterval
+		}
+	}
+}
+
+// jitter spreads d randomly by up to ±Options.Jitter.
+func (w *Waiter) jitter(d time.Duration) time.Duration {
+	delta := (rand.Float64()*2 - 1) * w.opts.Jitter * float64(d)
+	return d + time.Duration(delta)
+}